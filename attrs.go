@@ -0,0 +1,306 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RetryAttrs returns a consistent set of attributes describing a retry: the
+// current attempt, the maximum number of attempts, the delay before the next
+// attempt and the error from the last attempt. next_delay is left out on the
+// final attempt or when nextDelay is 0, and err is left out when lastErr is nil.
+func RetryAttrs(attempt, maxAttempts int, nextDelay time.Duration, lastErr error) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.Int("attempt", attempt),
+		slog.Int("max_attempts", maxAttempts),
+	}
+	if nextDelay > 0 && attempt < maxAttempts {
+		attrs = append(attrs, slog.Duration("next_delay", nextDelay))
+	}
+	if lastErr != nil {
+		attrs = append(attrs, slog.Any("err", lastErr))
+	}
+	return attrs
+}
+
+// DiffAttrs returns a group named field holding the old and new values of a
+// setting and whether it changed, rendered as field.old, field.new and
+// field.changed. Values are compared with reflect.DeepEqual.
+func DiffAttrs(field string, old, new any) []slog.Attr {
+	return []slog.Attr{
+		slog.Group(field,
+			slog.Any("old", old),
+			slog.Any("new", new),
+			slog.Bool("changed", !reflect.DeepEqual(old, new)),
+		),
+	}
+}
+
+// FlagAttrs returns the flags of fs that were set on the command line as a
+// group named flag, rendered as flag.<name>=<value>, to record the effective
+// configuration at startup. Values are taken from each flag's String method.
+// It returns nil if no flags were set.
+func FlagAttrs(fs *flag.FlagSet) []slog.Attr {
+	return flagAttrs(fs.Visit)
+}
+
+// AllFlagAttrs is like FlagAttrs but includes flags left at their default
+func AllFlagAttrs(fs *flag.FlagSet) []slog.Attr {
+	return flagAttrs(fs.VisitAll)
+}
+
+func flagAttrs(visit func(func(*flag.Flag))) []slog.Attr {
+	var attrs []any
+	visit(func(f *flag.Flag) {
+		attrs = append(attrs, slog.String(f.Name, f.Value.String()))
+	})
+	if len(attrs) == 0 {
+		return nil
+	}
+	return []slog.Attr{slog.Group("flag", attrs...)}
+}
+
+// SecretAttr returns an attribute for a secret value, such as an API key being
+// rotated, that always renders as a masked fingerprint: the first and last two
+// characters and the length, e.g. "ab...yz (len=32)". Values shorter than 8
+// characters are fully masked. The masking is done by a slog.LogValuer, so it
+// applies to every handler.
+func SecretAttr(key, value string) slog.Attr {
+	return slog.Any(key, secret(value))
+}
+
+// secret is a string that is masked whenever it is logged or formatted
+type secret string
+
+// LogValue implements slog.LogValuer
+func (s secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// String returns the masked fingerprint of s
+func (s secret) String() string {
+	n := utf8.RuneCountInString(string(s))
+	if n < 8 {
+		return fmt.Sprintf("*** (len=%d)", n)
+	}
+	r := []rune(string(s))
+	return fmt.Sprintf("%s...%s (len=%d)", string(r[:2]), string(r[n-2:]), n)
+}
+
+// GoString masks s when formatted with %#v
+func (s secret) GoString() string {
+	return s.String()
+}
+
+// StructDiffAttrs compares two structs of the same type, or pointers to them,
+// field by field and returns a group for each changed field holding its old
+// and new values, rendered as Field.old and Field.new. Nested structs are
+// compared recursively, e.g. DB.Host.old, and unexported fields are skipped.
+// Structs without exported fields or with their own String or Equal method,
+// such as time.Time, are compared as a whole.
+// It returns nil if nothing changed or old and new are not structs of the same
+// type.
+func StructDiffAttrs(old, new any) []slog.Attr {
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	for ov.Kind() == reflect.Pointer && nv.Kind() == reflect.Pointer && !ov.IsNil() && !nv.IsNil() {
+		ov, nv = ov.Elem(), nv.Elem()
+	}
+	if ov.Kind() != reflect.Struct || ov.Type() != nv.Type() {
+		return nil
+	}
+	return structDiff(ov, nv)
+}
+
+func structDiff(ov, nv reflect.Value) []slog.Attr {
+	var attrs []slog.Attr
+	for i := 0; i < ov.NumField(); i++ {
+		sf := ov.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		of, nf := ov.Field(i), nv.Field(i)
+		if diffByField(sf.Type) {
+			if nested := structDiff(of, nf); len(nested) > 0 {
+				attrs = append(attrs, slog.Attr{Key: sf.Name, Value: slog.GroupValue(nested...)})
+			}
+			continue
+		}
+		if reflect.DeepEqual(of.Interface(), nf.Interface()) {
+			continue
+		}
+		attrs = append(attrs, slog.Group(sf.Name,
+			slog.Any("old", of.Interface()),
+			slog.Any("new", nf.Interface()),
+		))
+	}
+	return attrs
+}
+
+// diffByField reports whether StructDiffAttrs compares values of type t field
+// by field: t is a struct with exported fields that does not define its own
+// String or Equal method
+func diffByField(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for _, name := range []string{"String", "Equal"} {
+		if _, ok := reflect.PointerTo(t).MethodByName(name); ok {
+			return false
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+// StartupAttrs returns the command line arguments under "args" and the
+// environment variables named in includeEnv, sorted by name, in an "env" group
+// for a one line startup audit record. Only the listed variables are logged,
+// so secrets can't leak from the rest of the environment, and unset ones are
+// left out. Names in redact, such as API_TOKEN or token, are masked as with
+// SecretAttr: the environment variable of that name and the value of the
+// command line flag of that name, given as -token value or --token=value.
+func StartupAttrs(includeEnv, redact []string) []slog.Attr {
+	names := slices.Clone(includeEnv)
+	slices.Sort(names)
+	names = slices.Compact(names)
+	vars := make([]any, 0, len(names))
+	for _, name := range names {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if slices.Contains(redact, name) {
+			vars = append(vars, SecretAttr(name, value))
+		} else {
+			vars = append(vars, slog.String(name, value))
+		}
+	}
+	return []slog.Attr{
+		slog.Any("args", redactArgs(os.Args, redact)),
+		slog.Group("env", vars...),
+	}
+}
+
+// redactArgs returns a copy of args with the values of the flags named in
+// redact masked. Arguments after a "--" terminator are not flags.
+func redactArgs(args, redact []string) []string {
+	args = slices.Clone(args)
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+		dashes := "-"
+		if arg[1] == '-' {
+			dashes = "--"
+		}
+		name, value, hasValue := strings.Cut(arg[len(dashes):], "=")
+		if !slices.Contains(redact, name) {
+			continue
+		}
+		if hasValue {
+			args[i] = dashes + name + "=" + secret(value).String()
+		} else if i+1 < len(args) {
+			i++
+			args[i] = secret(args[i]).String()
+		}
+	}
+	return args
+}
+
+// ParseKVAttrs parses a logfmt style line such as `a=1 msg="hello world"`,
+// e.g. from the output of a wrapped tool, into attributes. Quoted keys and
+// values use Go escapes, as written by the handler, and are always strings.
+// Unquoted values are parsed as an int, float or bool when they look like one
+// and are strings otherwise. A word without "=" becomes a key with an empty
+// value. Dotted keys such as http.status are kept as-is.
+func ParseKVAttrs(s string) []slog.Attr {
+	var attrs []slog.Attr
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return attrs
+		}
+		var key string
+		key, s, _ = cutKVToken(s, true)
+		if !strings.HasPrefix(s, "=") {
+			attrs = append(attrs, slog.String(key, ""))
+			continue
+		}
+		value, rest, quoted := cutKVToken(s[1:], false)
+		s = rest
+		if quoted {
+			attrs = append(attrs, slog.String(key, value))
+		} else {
+			attrs = append(attrs, slog.Attr{Key: key, Value: parseKVValue(value)})
+		}
+	}
+}
+
+// cutKVToken cuts a key, when isKey is set, or a value from the start of s. A
+// quoted token is unquoted, an unterminated quote is kept as-is.
+func cutKVToken(s string, isKey bool) (token, rest string, quoted bool) {
+	if strings.HasPrefix(s, `"`) {
+		if q, err := strconv.QuotedPrefix(s); err == nil {
+			if token, err := strconv.Unquote(q); err == nil {
+				return token, s[len(q):], true
+			}
+		}
+	}
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || (isKey && r == '=')
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	return s[:end], s[end:], false
+}
+
+// parseKVValue returns the value of an unquoted token
+func parseKVValue(s string) slog.Value {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return slog.Int64Value(n)
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return slog.Float64Value(f)
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		return slog.BoolValue(b)
+	}
+	return slog.StringValue(s)
+}
+
+// Lazy returns a value that calls f to compute what is logged only when a
+// record holding it is written, e.g.
+//
+//	logger.Debug("state", slog.Any("dump", cli.Lazy(expensiveDump)))
+//
+// f is not called for records below the logger's level. Attributes passed to
+// Logger.With are resolved when With is called.
+func Lazy(f func() any) slog.LogValuer {
+	return lazyValue(f)
+}
+
+// lazyValue is a function whose result is logged in its place
+type lazyValue func() any
+
+// LogValue implements slog.LogValuer
+func (f lazyValue) LogValue() slog.Value {
+	return slog.AnyValue(f())
+}
@@ -0,0 +1,295 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// formatAttrs renders attrs with a colorless handler and returns the
+// attribute portion of the line
+func formatAttrs(t *testing.T, attrs ...slog.Attr) string {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+		NoColor:     true,
+	}))
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "", attrs...)
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func TestRetryAttrs(t *testing.T) {
+	err := errors.New("timeout")
+	for _, test := range []struct {
+		name  string
+		attrs []slog.Attr
+		want  string
+	}{
+		{
+			name:  "first attempt",
+			attrs: RetryAttrs(1, 3, time.Second, nil),
+			want:  `attempt=1 max_attempts=3 next_delay="1s"`,
+		},
+		{
+			name:  "mid retry",
+			attrs: RetryAttrs(2, 3, 2*time.Second, err),
+			want:  `attempt=2 max_attempts=3 next_delay="2s" err="timeout"`,
+		},
+		{
+			name:  "final attempt",
+			attrs: RetryAttrs(3, 3, 4*time.Second, err),
+			want:  `attempt=3 max_attempts=3 err="timeout"`,
+		},
+	} {
+		if got := formatAttrs(t, test.attrs...); got != test.want {
+			t.Errorf("%s\ngot  %s\nwant %s", test.name, got, test.want)
+		}
+	}
+}
+
+type diffConfig struct {
+	Host string
+	Mode string
+}
+
+func TestDiffAttrs(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		attrs []slog.Attr
+		want  string
+	}{
+		{
+			name:  "changed",
+			attrs: DiffAttrs("port", 80, 8080),
+			want:  `port.old=80 port.new=8080 port.changed=true`,
+		},
+		{
+			name:  "unchanged",
+			attrs: DiffAttrs("host", "localhost", "localhost"),
+			want:  `host.old="localhost" host.new="localhost" host.changed=false`,
+		},
+		{
+			name:  "struct changed",
+			attrs: DiffAttrs("cfg", diffConfig{"a", "dev"}, diffConfig{"a", "prod"}),
+			want:  `cfg.old="{a dev}" cfg.new="{a prod}" cfg.changed=true`,
+		},
+		{
+			name:  "struct unchanged",
+			attrs: DiffAttrs("cfg", diffConfig{"a", "dev"}, diffConfig{"a", "dev"}),
+			want:  `cfg.old="{a dev}" cfg.new="{a dev}" cfg.changed=false`,
+		},
+	} {
+		if got := formatAttrs(t, test.attrs...); got != test.want {
+			t.Errorf("%s\ngot  %s\nwant %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFlagAttrs(t *testing.T) {
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	fs.String("name", "anon", "")
+	fs.Int("port", 80, "")
+	fs.Bool("verbose", false, "")
+	fs.Duration("timeout", time.Second, "")
+	if err := fs.Parse([]string{"-port", "8080", "-verbose", "-name", "two words"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `flag.name="two words" flag.port="8080" flag.verbose="true"`
+	if got := formatAttrs(t, FlagAttrs(fs)...); got != want {
+		t.Errorf("set flags\ngot  %s\nwant %s", got, want)
+	}
+	want = `flag.name="two words" flag.port="8080" flag.timeout="1s" flag.verbose="true"`
+	if got := formatAttrs(t, AllFlagAttrs(fs)...); got != want {
+		t.Errorf("all flags\ngot  %s\nwant %s", got, want)
+	}
+	if attrs := FlagAttrs(flag.NewFlagSet("empty", flag.ContinueOnError)); attrs != nil {
+		t.Errorf("got %v for no set flags, want nil", attrs)
+	}
+}
+
+func TestSecretAttr(t *testing.T) {
+	const key = "sk-live-0123456789abcdef"
+	for _, test := range []struct {
+		attr slog.Attr
+		want string
+	}{
+		{SecretAttr("api_key", key), `api_key="sk...ef (len=24)"`},
+		{SecretAttr("pin", "1234"), `pin="*** (len=4)"`},
+		{slog.Group("rotate", SecretAttr("old", key)), `rotate.old="sk...ef (len=24)"`},
+	} {
+		if got := formatAttrs(t, test.attr); got != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+
+	// other handlers and formatting never see the raw value
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("m", SecretAttr("api_key", key))
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("m", SecretAttr("api_key", key))
+	fmt.Fprintf(&buf, "%v %s %+v %#v", secret(key), secret(key), secret(key), secret(key))
+	if strings.Contains(buf.String(), "0123456789") {
+		t.Errorf("raw secret leaked: %s", buf.String())
+	}
+}
+
+type dbConfig struct {
+	Host string
+	Port int
+}
+
+type appConfig struct {
+	Name    string
+	Debug   bool
+	DB      dbConfig
+	Tags    []string
+	Updated time.Time
+	version string
+}
+
+func TestStructDiffAttrs(t *testing.T) {
+	old := appConfig{Name: "app", DB: dbConfig{"localhost", 5432}, Tags: []string{"a"}, version: "1"}
+	for _, test := range []struct {
+		name  string
+		attrs []slog.Attr
+		want  string
+	}{
+		{
+			name: "one changed field",
+			attrs: StructDiffAttrs(old, appConfig{Name: "app", Debug: true,
+				DB: dbConfig{"localhost", 5432}, Tags: []string{"a"}, version: "1"}),
+			want: `Debug.old=false Debug.new=true`,
+		},
+		{
+			name: "nested and pointers",
+			attrs: StructDiffAttrs(&old, &appConfig{Name: "app",
+				DB: dbConfig{"db.internal", 5432}, Tags: []string{"a", "b"}, version: "2"}),
+			want: `DB.Host.old="localhost" DB.Host.new="db.internal" Tags.old="[a]" Tags.new="[a b]"`,
+		},
+		{
+			name: "time",
+			attrs: StructDiffAttrs(old, appConfig{Name: "app", DB: dbConfig{"localhost", 5432},
+				Tags: []string{"a"}, Updated: testTime, version: "1"}),
+			want: `Updated.old="0001-01-01 00:00:00" Updated.new="2000-01-02 03:04:05"`,
+		},
+	} {
+		if got := formatAttrs(t, test.attrs...); got != test.want {
+			t.Errorf("%s\ngot  %s\nwant %s", test.name, got, test.want)
+		}
+	}
+
+	if attrs := StructDiffAttrs(old, old); attrs != nil {
+		t.Errorf("got %v for equal structs, want nil", attrs)
+	}
+	if attrs := StructDiffAttrs(old, dbConfig{}); attrs != nil {
+		t.Errorf("got %v for different types, want nil", attrs)
+	}
+}
+
+func TestStartupAttrs(t *testing.T) {
+	const token = "tok_0123456789abcdef"
+	t.Setenv("CLI_TEST_TOKEN", token)
+	t.Setenv("CLI_TEST_REGION", "us-east-1")
+	t.Setenv("CLI_TEST_SECRET", "not listed")
+	origArgs := os.Args
+	os.Args = []string{"app", "-v", "--token=" + token, "-password", "hunter22", "serve", "--", "-token", "x"}
+	t.Cleanup(func() { os.Args = origArgs })
+
+	attrs := StartupAttrs(
+		[]string{"CLI_TEST_TOKEN", "CLI_TEST_REGION", "CLI_TEST_UNSET"},
+		[]string{"CLI_TEST_TOKEN", "token", "password"},
+	)
+	got := formatAttrs(t, attrs...)
+	want := `args="[app -v --token=to...ef (len=20) -password hu...22 (len=8) serve -- -token x]" ` +
+		`env.CLI_TEST_REGION="us-east-1" env.CLI_TEST_TOKEN="to...ef (len=20)"`
+	if got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestParseKVAttrs(t *testing.T) {
+	got := ParseKVAttrs(`  a=1 f=1.5 ok=true s="two words" bare path=/tmp/x ""="empty key" q="say \"hi\"\n" open="x`)
+	want := []slog.Attr{
+		slog.Int64("a", 1),
+		slog.Float64("f", 1.5),
+		slog.Bool("ok", true),
+		slog.String("s", "two words"),
+		slog.String("bare", ""),
+		slog.String("path", "/tmp/x"),
+		slog.String("", "empty key"),
+		slog.String("q", "say \"hi\"\n"),
+		slog.String("open", `"x`),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d attrs %v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("attr %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseKVAttrsQuoteRoundTrip(t *testing.T) {
+	for _, s := range []string{"plain", "two words", `a "quoted" word`, "tab\there", "line\nbreak", "k=v", "", "ünïcode ✓", "\x00\x1b[31m"} {
+		for _, appendValue := range []func(*buffer, string){appendQuote, appendAutoQuote} {
+			buf := newBuffer()
+			buf.WriteString("key=")
+			appendValue(buf, s)
+			line := string(*buf)
+			buf.Free()
+
+			attrs := ParseKVAttrs(line)
+			if len(attrs) != 1 || attrs[0].Key != "key" || attrs[0].Value.String() != s {
+				t.Errorf("ParseKVAttrs(%q) = %v, want key=%q", line, attrs, s)
+			}
+		}
+	}
+}
+
+func TestParseKVAttrsHandlerRoundTrip(t *testing.T) {
+	line := formatAttrs(t,
+		slog.Int("n", -3),
+		slog.Float64("ratio", 0.25),
+		slog.Bool("ok", false),
+		slog.String("msg", `say "hi"`),
+		slog.Group("http", slog.Int("status", 200)),
+	)
+	if got := formatAttrs(t, ParseKVAttrs(line)...); got != line {
+		t.Errorf("round trip:\ngot  %q\nwant %q", got, line)
+	}
+}
+
+func TestLazy(t *testing.T) {
+	calls := 0
+	dump := func() any {
+		calls++
+		return "snapshot"
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		Level:       slog.LevelInfo,
+		ReplaceAttr: removeKeys(slog.TimeKey),
+	}))
+	logger.Debug("state", slog.Any("dump", Lazy(dump)))
+	if calls != 0 || buf.Len() != 0 {
+		t.Fatalf("disabled record: %d calls, output %q", calls, buf.String())
+	}
+
+	logger.Info("state", slog.Any("dump", Lazy(dump)), slog.Any("n", Lazy(func() any { return 42 })))
+	if calls != 1 {
+		t.Errorf("enabled record: %d calls, want 1", calls)
+	}
+	if got, want := buf.String(), " INFO state dump=\"snapshot\" n=42\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
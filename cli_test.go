@@ -2,14 +2,30 @@ package cli
 
 import (
 	"bytes"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 	"testing"
 
+	"github.com/fatih/color"
 	"github.com/stretchr/testify/assert"
 )
 
+// setColor sets the color status for the rest of the test
+func setColor(t *testing.T, colorOn bool) {
+	noColor := color.NoColor
+	SetColor(colorOn)
+	t.Cleanup(func() { color.NoColor = noColor })
+}
+
+// setOutputWriter sets the output writer for the rest of the test
+func setOutputWriter(t *testing.T, w io.Writer) {
+	orig := outWriter
+	SetOutputWriter(w)
+	t.Cleanup(func() { SetOutputWriter(orig) })
+}
+
 func TestColorPrint(t *testing.T) {
 	SetPrintLevel(LevelError)
 	stdOut := new(bytes.Buffer)
@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"log/slog"
+	"time"
+)
+
+// clock returns the current time. It is the default Clock of every handler,
+// so helpers logging through a handler and helpers with no handler at hand,
+// such as Timer and the rotating writer, read the same time. Tests replace it
+// to get deterministic output.
+var clock = time.Now
+
+// loggerNow returns the current time from the clock of logger's handler, set
+// by HandlerOptions.Clock, or from clock if the handler is not a *Handler
+func loggerNow(logger *slog.Logger) time.Time {
+	if h, ok := logger.Handler().(*Handler); ok {
+		return h.now()
+	}
+	return clock()
+}
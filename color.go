@@ -0,0 +1,61 @@
+package cli
+
+import "sync/atomic"
+
+// globalNoColor disables color for every handler when set
+var globalNoColor atomic.Bool
+
+// SetGlobalNoColor disables color for all handlers, existing and new, when
+// noColor is true, e.g. for deterministic output in snapshot tests. It takes
+// precedence over every other color input. Setting it back to false restores
+// each handler's own color setting.
+func SetGlobalNoColor(noColor bool) {
+	globalNoColor.Store(noColor)
+}
+
+// colorInputs holds everything that takes part in deciding whether a handler
+// writes ANSI color codes
+type colorInputs struct {
+	noColor    bool   // HandlerOptions.NoColor
+	forceColor bool   // HandlerOptions.ForceColor
+	forceEnv   string // value of the FORCE_COLOR environment variable
+	noColorEnv string // value of the NO_COLOR environment variable
+	term       string // value of the TERM environment variable
+	logFile    bool   // the writer is a log file such as a RotatingWriter
+	tty        bool   // the writer is a terminal, or HandlerOptions.ForceTTY
+}
+
+// resolveColor decides whether color is enabled for a new handler. Inputs are
+// considered in order of precedence, highest first:
+//
+//  1. HandlerOptions.NoColor disables color
+//  2. HandlerOptions.ForceColor enables color
+//  3. writing to a log file disables color
+//  4. a FORCE_COLOR environment variable set to anything but "", "0" or
+//     "false" enables color
+//  5. a non-empty NO_COLOR environment variable disables color, see
+//     https://no-color.org
+//  6. TERM=dumb disables color
+//  7. writing to anything but a terminal, such as a pipe, disables color
+//  8. otherwise color is enabled
+//
+// SetGlobalNoColor overrides the result for all handlers when they write.
+func resolveColor(in colorInputs) bool {
+	switch {
+	case in.noColor:
+		return false
+	case in.forceColor:
+		return true
+	case in.logFile:
+		return false
+	case in.forceEnv != "" && in.forceEnv != "0" && in.forceEnv != "false":
+		return true
+	case in.noColorEnv != "":
+		return false
+	case in.term == "dumb":
+		return false
+	case !in.tty:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestResolveColor(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   colorInputs
+		want bool
+	}{
+		{"default", colorInputs{tty: true}, true},
+		{"term", colorInputs{term: "xterm-256color", tty: true}, true},
+		{"not a terminal", colorInputs{term: "xterm"}, false},
+		{"force color not a terminal", colorInputs{forceColor: true}, true},
+		{"no color", colorInputs{noColor: true}, false},
+		{"dumb term", colorInputs{term: "dumb"}, false},
+		{"no color dumb term", colorInputs{noColor: true, term: "dumb"}, false},
+		{"log file", colorInputs{logFile: true}, false},
+		{"log file term", colorInputs{logFile: true, term: "xterm"}, false},
+		{"no color env", colorInputs{noColorEnv: "1", term: "xterm"}, false},
+		{"force color", colorInputs{forceColor: true, noColorEnv: "1", term: "dumb"}, true},
+		{"force color log file", colorInputs{forceColor: true, logFile: true}, true},
+		{"no color force color", colorInputs{noColor: true, forceColor: true}, false},
+		{"force color env", colorInputs{forceEnv: "1", noColorEnv: "1", term: "dumb"}, true},
+		{"force color env zero", colorInputs{forceEnv: "0"}, false},
+		{"force color env false", colorInputs{forceEnv: "false", tty: true}, true},
+		{"force color env log file", colorInputs{forceEnv: "1", logFile: true}, false},
+		{"no color force color env", colorInputs{noColor: true, forceEnv: "1"}, false},
+	} {
+		if got := resolveColor(test.in); got != test.want {
+			t.Errorf("%s: resolveColor(%+v) = %v, want %v", test.name, test.in, got, test.want)
+		}
+	}
+}
+
+func TestSetGlobalNoColor(t *testing.T) {
+	t.Cleanup(func() { SetGlobalNoColor(false) })
+
+	var buf bytes.Buffer
+	existing := slog.New(NewHandler(&buf, &HandlerOptions{ForceColor: true, ReplaceAttr: removeKeys(slog.TimeKey)}))
+	SetGlobalNoColor(true)
+	h := NewHandler(&buf, &HandlerOptions{ForceColor: true, ReplaceAttr: removeKeys(slog.TimeKey), ColorWholeLine: true})
+	created := slog.New(h)
+
+	existing.Warn("m", "a", 1)
+	created.Error("m", "err", errors.New("fail"))
+	if got, want := buf.String(), " WARN m a=1\nERROR m err=\"fail\"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if h.(*Handler).ColorEnabled() {
+		t.Error("ColorEnabled reports true with the global no color flag set")
+	}
+
+	SetGlobalNoColor(false)
+	buf.Reset()
+	existing.Warn("m")
+	if !strings.Contains(buf.String(), string(cliFgYellow)) {
+		t.Errorf("color was not restored after clearing the global flag: %q", buf.String())
+	}
+}
+
+func TestNoColorEnv(t *testing.T) {
+	t.Setenv("TERM", "xterm")
+	fakeTerminal(t, true)
+	t.Setenv("NO_COLOR", "1")
+
+	var buf bytes.Buffer
+	slog.New(NewHandler(&buf, &HandlerOptions{ReplaceAttr: removeKeys(slog.TimeKey)})).Warn("m")
+	if got, want := buf.String(), " WARN m\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	slog.New(NewHandler(&buf, &HandlerOptions{ReplaceAttr: removeKeys(slog.TimeKey), ForceColor: true})).Warn("m")
+	if !strings.Contains(buf.String(), string(cliFgYellow)) {
+		t.Errorf("ForceColor did not override NO_COLOR: %q", buf.String())
+	}
+}
+
+func TestColorTerminalDetection(t *testing.T) {
+	t.Setenv("TERM", "xterm")
+	for _, test := range []struct {
+		name string
+		opts HandlerOptions
+		want bool
+	}{
+		{"buffer", HandlerOptions{}, false},
+		{"force color", HandlerOptions{ForceColor: true}, true},
+		{"force tty", HandlerOptions{ForceTTY: true}, true},
+		{"force color no color", HandlerOptions{ForceColor: true, NoColor: true}, false},
+	} {
+		var buf bytes.Buffer
+		slog.New(NewHandler(&buf, &test.opts)).Warn("m")
+		if got := strings.Contains(buf.String(), string(cliFgYellow)); got != test.want {
+			t.Errorf("%s: colored = %v, want %v: %q", test.name, got, test.want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LogError logs msg at error level with err under the "err" key along with any
+// extra attrs, then returns err unchanged so call sites can write
+//
+//	return cli.LogError(logger, "failed to open config", err)
+func LogError(logger *slog.Logger, msg string, err error, attrs ...slog.Attr) error {
+	attrs = append([]slog.Attr{slog.Any("err", err)}, attrs...)
+	logAt(logger, slog.LevelError, msg, attrs, 1)
+	return err
+}
+
+// FieldError is a validation failure for the field at Path, a dotted path
+// such as "user.email"
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+// LogValidationErrors logs msg at level, typically slog.LevelWarn or
+// slog.LevelError, with each field error nested under an "errors" group by
+// its path, e.g. errors.user.email="is required". Nothing is logged when errs
+// is empty.
+func LogValidationErrors(logger *slog.Logger, level slog.Level, msg string, errs []FieldError) {
+	if len(errs) == 0 {
+		return
+	}
+	logAt(logger, level, msg, []slog.Attr{ValidationAttr(errs)}, 1)
+}
+
+// ValidationAttr returns errs as an "errors" group attribute, nesting a group
+// for each segment of the field paths. Fields sharing a parent are kept
+// together in the order the parent first appears.
+func ValidationAttr(errs []FieldError) slog.Attr {
+	segs := make([][]string, len(errs))
+	for i, e := range errs {
+		segs[i] = strings.Split(e.Path, ".")
+	}
+	return slog.Attr{Key: "errors", Value: slog.GroupValue(fieldErrorAttrs(errs, segs)...)}
+}
+
+// fieldErrorAttrs builds the attributes for errs, where segs holds the
+// remaining path segments of each error
+func fieldErrorAttrs(errs []FieldError, segs [][]string) []slog.Attr {
+	var attrs []slog.Attr
+	done := make([]bool, len(errs))
+	for i := range errs {
+		if done[i] {
+			continue
+		}
+		name := segs[i][0]
+		if len(segs[i]) == 1 {
+			attrs = append(attrs, slog.String(name, errs[i].Message))
+			continue
+		}
+
+		var childErrs []FieldError
+		var childSegs [][]string
+		for j := i; j < len(errs); j++ {
+			if !done[j] && len(segs[j]) > 1 && segs[j][0] == name {
+				childErrs = append(childErrs, errs[j])
+				childSegs = append(childSegs, segs[j][1:])
+				done[j] = true
+			}
+		}
+		attrs = append(attrs, slog.Attr{Key: name, Value: slog.GroupValue(fieldErrorAttrs(childErrs, childSegs)...)})
+	}
+	return attrs
+}
+
+// ErrorCollector gathers the errors of a batch operation so they can be
+// reported in a single summary record. The zero value is ready to use and it
+// is safe for concurrent use.
+type ErrorCollector struct {
+	// Detail adds each collected error and its attrs to the summary under an
+	// "errors" group, keyed by the order they were added
+	Detail bool
+
+	mu   sync.Mutex
+	errs []collectedError
+}
+
+type collectedError struct {
+	err   error
+	attrs []slog.Attr
+}
+
+// Add collects err along with attrs describing it, nil errors are ignored
+func (c *ErrorCollector) Add(err error, attrs ...slog.Attr) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs = append(c.errs, collectedError{err: err, attrs: attrs})
+}
+
+// Len returns the number of errors collected
+func (c *ErrorCollector) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.errs)
+}
+
+// LogSummary logs a single record summarizing the collected errors: the
+// number of errors and the message of the first one at error level, or an info
+// record when there were no errors.
+func (c *ErrorCollector) LogSummary(logger *slog.Logger) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.errs) == 0 {
+		logAt(logger, slog.LevelInfo, "no errors", []slog.Attr{slog.Int("errors", 0)}, 1)
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.Int("errors", len(c.errs)),
+		slog.String("first_error", c.errs[0].err.Error()),
+	}
+	if c.Detail {
+		detail := make([]any, len(c.errs))
+		for i, e := range c.errs {
+			args := []any{slog.Any("err", e.err)}
+			for _, attr := range e.attrs {
+				args = append(args, attr)
+			}
+			detail[i] = slog.Group(strconv.Itoa(i+1), args...)
+		}
+		attrs = append(attrs, slog.Group("errors", detail...))
+	}
+	logAt(logger, slog.LevelError, "finished with errors", attrs, 1)
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLogError(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+
+	err := errors.New("no such file")
+	got := LogError(logger, "failed to open config", err, slog.String("path", "/etc/app.conf"))
+
+	if got != err {
+		t.Errorf("LogError returned %v, want the original error", got)
+	}
+	want := "ERROR failed to open config err=\"no such file\" path=\"/etc/app.conf\"\n"
+	if buf.String() != want {
+		t.Errorf("\ngot  %q\nwant %q", buf.String(), want)
+	}
+}
+
+func TestLogValidationErrors(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+
+	LogValidationErrors(logger, slog.LevelWarn, "invalid config", []FieldError{
+		{Path: "user.email", Message: "is required"},
+		{Path: "port", Message: "must be positive"},
+		{Path: "user.name", Message: "too long"},
+		{Path: "db.pool.size", Message: "must be at most 100"},
+	})
+	LogValidationErrors(logger, slog.LevelWarn, "valid config", nil)
+
+	want := ` WARN invalid config errors.user.email="is required" errors.user.name="too long" ` +
+		`errors.port="must be positive" errors.db.pool.size="must be at most 100"` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestValidationAttrGroups(t *testing.T) {
+	var groups [][]string
+	h := NewHandler(io.Discard, &HandlerOptions{
+		ReplaceAttr: func(g []string, a slog.Attr) slog.Attr {
+			if len(g) > 0 {
+				groups = append(groups, slices.Clone(g))
+			}
+			return a
+		},
+	})
+	slog.New(h).LogAttrs(context.Background(), slog.LevelError, "m",
+		ValidationAttr([]FieldError{{Path: "user.email", Message: "bad"}}))
+
+	want := [][]string{{"errors", "user"}}
+	if !slices.EqualFunc(groups, want, slices.Equal[[]string]) {
+		t.Errorf("got %q, want %q", groups, want)
+	}
+}
+
+func TestErrorCollector(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		errs   []error
+		detail bool
+		want   string
+	}{
+		{
+			name: "zero",
+			want: ` INFO no errors errors=0`,
+		},
+		{
+			name: "one",
+			errs: []error{errors.New("disk full")},
+			want: `ERROR finished with errors errors=1 first_error="disk full"`,
+		},
+		{
+			name: "many",
+			errs: []error{errors.New("disk full"), nil, errors.New("timeout"), errors.New("denied")},
+			want: `ERROR finished with errors errors=3 first_error="disk full"`,
+		},
+		{
+			name:   "many with detail",
+			errs:   []error{errors.New("disk full"), errors.New("timeout")},
+			detail: true,
+			want: `ERROR finished with errors errors=2 first_error="disk full" ` +
+				`errors.1.err="disk full" errors.1.item=0 errors.2.err="timeout" errors.2.item=1`,
+		},
+	} {
+		var buf bytes.Buffer
+		logger := slog.New(NewHandler(&buf, &HandlerOptions{
+			ReplaceAttr: removeKeys(slog.TimeKey),
+			NoColor:     true,
+		}))
+
+		c := ErrorCollector{Detail: test.detail}
+		for i, err := range test.errs {
+			c.Add(err, slog.Int("item", i))
+		}
+		c.LogSummary(logger)
+
+		if got := strings.TrimRight(buf.String(), "\n"); got != test.want {
+			t.Errorf("%s\ngot  %s\nwant %s", test.name, got, test.want)
+		}
+	}
+}
@@ -1,19 +1,29 @@
 package cli
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"encoding"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
 	"log/slog"
+	"math"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/mattn/go-colorable"
 )
@@ -61,12 +71,89 @@ const (
 	cliFgHiWhite   = cliColor("\033[97m")
 )
 
+// hashPalette is the set of colors that values of HashColorKeys are mapped onto
+var hashPalette = []cliColor{
+	cliFgGreen, cliFgYellow, cliFgBlue, cliFgMagenta, cliFgCyan,
+	cliFgHiGreen, cliFgHiYellow, cliFgHiBlue, cliFgHiMagenta, cliFgHiCyan,
+}
+
+// EmptyKeyMode controls how attributes with an empty key are written
+type EmptyKeyMode int
+
+const (
+	// EmptyKeyQuote writes the empty key as a quoted empty string: ""="v"
+	EmptyKeyQuote EmptyKeyMode = iota
+	// EmptyKeyDrop leaves attributes with an empty key out of the output
+	EmptyKeyDrop
+	// EmptyKeyPlaceholder writes the empty key as HandlerOptions.EmptyKeyName
+	EmptyKeyPlaceholder
+)
+
+// BytesFormat sets how []byte values are written
+type BytesFormat int
+
+const (
+	// BytesString writes byte slices as text, quoted when needed
+	BytesString BytesFormat = iota
+	// BytesHexDump writes byte slices as space separated hex pairs, e.g.
+	// "00 01 02 03". Slices longer than HandlerOptions.HexDumpMaxLen show only
+	// their head and tail.
+	BytesHexDump
+)
+
+// KeyEscapeMode controls how equals signs and spaces in attribute keys are
+// written
+type KeyEscapeMode int
+
+const (
+	// KeyEscapeQuote quotes keys containing equals signs or spaces: "a=b"=1
+	KeyEscapeQuote KeyEscapeMode = iota
+	// KeyEscapeStrip removes equals signs and spaces from keys: ab=1
+	KeyEscapeStrip
+	// KeyEscapeReplace replaces equals signs and spaces in keys with
+	// underscores: a_b=1
+	KeyEscapeReplace
+)
+
+// AttrStyle sets how record attributes are written
+type AttrStyle int
+
+const (
+	// AttrStyleLogfmt writes attributes as space separated key=value pairs
+	AttrStyleLogfmt AttrStyle = iota
+	// AttrStyleQuery writes attributes as a URL query string, e.g.
+	// ?a=1&b=two+words, with keys and values query escaped
+	AttrStyleQuery
+)
+
+// DurationThreshold colors duration values at or above At with Color, an ANSI
+// escape sequence such as "\033[31m"
+type DurationThreshold struct {
+	At    time.Duration
+	Color string
+}
+
 // HandlerOptions is a drop in replacement for [slog.HandlerOptions]
 type HandlerOptions struct {
 	// AddSource causes the handler to compute the source code position
 	// of the log statement and add a SourceKey attribute to the output.
 	AddSource bool
 
+	// SourceModuleRoot renders source paths relative to this directory when
+	// the file is located under it (Default: "", dir/file is shown)
+	SourceModuleRoot string
+
+	// SourceFrames is the number of call stack frames written by AddSource,
+	// starting at the log call. More than one frame is written as a source
+	// group of attributes, source.0, source.1 and so on, instead of the source
+	// column. Frames past the first are only available when the record is
+	// handled on the goroutine that logged it. (Default: 1)
+	SourceFrames int
+
+	// SourceBasenameOnly renders only the file name of the source path,
+	// overriding SourceModuleRoot (Default: false)
+	SourceBasenameOnly bool
+
 	// Level reports the minimum record level that will be logged.
 	// The handler discards records with lower levels.
 	// If Level is nil, the handler assumes LevelInfo.
@@ -74,6 +161,10 @@ type HandlerOptions struct {
 	// to adjust the minimum level dynamically, use a LevelVar.
 	Level slog.Leveler
 
+	// LevelEnvVar names an environment variable (e.g. "LOG_LEVEL") that, when
+	// set to a valid level name, overrides Level. Invalid values are ignored.
+	LevelEnvVar string
+
 	// ReplaceAttr is called to rewrite each non-group attribute before it is logged.
 	// The attribute's value has been resolved (see [Value.Resolve]).
 	// If ReplaceAttr returns a zero Attr, the attribute is discarded.
@@ -101,32 +192,488 @@ type HandlerOptions struct {
 	// remove attributes from the output.
 	ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
 
-	// Time format (Default: time.DateTime)
+	// SyslogLevelNames renders levels with syslog severity names: DEBUG,
+	// INFO, NOTICE (INFO+2), WARNING, ERR and CRIT (ERROR+4) (Default: false)
+	SyslogLevelNames bool
+
+	// NameStandardOnly writes the names of the standard levels but custom
+	// levels as their number, e.g. 2 instead of INFO+2, for tools that parse
+	// the level column (Default: false)
+	NameStandardOnly bool
+
+	// CustomLevelColors labels and colors ranges of levels, such as custom
+	// levels between the standard ones that would otherwise be written as
+	// INFO+2. The first matching style is used and the level column widens to
+	// fit its labels. Custom levels without a style, or a style without a
+	// color, take the color of the standard level below them, e.g. ERROR+4 is
+	// red.
+	CustomLevelColors []LevelStyle
+
+	// LevelRenderer, when set, fully controls the level column. It returns the
+	// exact text written for level, including any padding and color codes,
+	// and is told whether color is off. The level options below and
+	// CustomLevelColors only apply to the built-in rendering.
+	LevelRenderer func(level slog.Level, noColor bool) string
+
+	// LevelColors overrides the color, an ANSI escape sequence such as
+	// "\033[35m", of individual levels. Levels not in the map keep their
+	// default color. (Default: nil)
+	LevelColors map[slog.Level]string
+
+	// LevelLabels overrides the label written for individual levels, e.g.
+	// "info" or "I". The level column is sized to the longest label of the
+	// standard levels, so shorter labels make it narrower. (Default: nil)
+	LevelLabels map[slog.Level]string
+
+	// LevelPrefixes sets a marker written before the level of individual
+	// levels, e.g. ">> " for INFO and "!! " for ERROR. Levels without a prefix
+	// are indented to the widest prefix so the columns line up. (Default: nil)
+	LevelPrefixes map[slog.Level]string
+
+	// LevelWidth pins the width of the level column, padding shorter labels on
+	// the left and truncating longer ones (Default: 0, sized to the built-in labels)
+	LevelWidth int
+
+	// ThousandsSeparator groups the digits of integer and float values in
+	// threes, e.g. 32,768. Floats in scientific notation are left unchanged.
+	// (Default: false)
+	ThousandsSeparator bool
+
+	// ThousandsSeparatorRune is the rune placed between digit groups (Default: ',')
+	ThousandsSeparatorRune rune
+
+	// MessageWidth pads messages on the right to at least this many columns so
+	// the attributes that follow line up (Default: 0)
+	MessageWidth int
+
+	// ValueWidth pads attribute values to at least this many columns. Numbers
+	// are right aligned and other values left aligned. (Default: 0)
+	ValueWidth int
+
+	// Columnar lays records out in aligned columns. It is a preset for the
+	// alignment options: LevelWidth is pinned to the widest level label,
+	// MessageWidth defaults to 24 and ValueWidth to 8. Explicitly set
+	// options take precedence. (Default: false)
+	Columnar bool
+
+	// StripMessageANSI removes ANSI escape sequences embedded in record
+	// messages, leaving the handler's own coloring intact (Default: false)
+	StripMessageANSI bool
+
+	// GroupPathColumn writes the groups opened with WithGroup once as a
+	// column before the message, e.g. [http.request], instead of prefixing
+	// each attribute key with them (Default: false)
+	GroupPathColumn bool
+
+	// Time format, a time layout or one of the reserved keywords TimeFormatUnix,
+	// TimeFormatUnixMilli or TimeFormatUnixNano (Default: time.DateTime)
 	TimeFormat string
 
+	// DisableTime leaves the time out of every line, so the level comes
+	// first, e.g. when a log collector already timestamps each line
+	// (Default: false)
+	DisableTime bool
+
+	// UTC converts record times to UTC before formatting (Default: false)
+	UTC bool
+
 	// Disable color (Default: false)
 	NoColor bool
+
+	// ForceColor enables color even when it would otherwise be turned off,
+	// such as by the NO_COLOR environment variable or when writing to a
+	// pipe, a bytes.Buffer or a log file. NoColor still takes precedence.
+	// (Default: false, color is only used on terminals)
+	ForceColor bool
+
+	// ForceTTY makes the handler treat its writer as an interactive terminal,
+	// e.g. so progress is drawn in place when writing to a bytes.Buffer in
+	// tests (Default: false, detected from the writer)
+	ForceTTY bool
+
+	// TerminalWidth sets the width of the terminal in columns, used by error
+	// cards and progress bars (Default: 0, from the COLUMNS environment
+	// variable or 80)
+	TerminalWidth int
+
+	// ColorWholeLine colors the whole line of debug, warn and error records
+	// with the level color. Keys and values with their own color return to the
+	// line color after them. (Default: false)
+	ColorWholeLine bool
+
+	// LineColorFromContext extracts a color, an ANSI escape sequence such as
+	// "\033[35m", from the context passed to Handle. When it reports ok the
+	// whole line is written in that color, taking precedence over
+	// ColorWholeLine, e.g. to highlight the records of a single request.
+	LineColorFromContext func(ctx context.Context) (color string, ok bool)
+
+	// ErrorWithType follows error values with their concrete type, e.g.
+	// err="fail" (type=*errors.errorString) (Default: false)
+	ErrorWithType bool
+
+	// MultilineDelimiters are written around values that span several lines,
+	// such as the stack from DumpStack or values made with Multiline, e.g.
+	// [2]string{"<<", ">>"} writes the opening marker after the key and the
+	// closing one on its own line, so a parser can tell where the value ends
+	// (Default: none, the value is only set apart by its indented lines)
+	MultilineDelimiters [2]string
+
+	// StructUseJSONTags writes struct values, and pointers to them, as
+	// {name:value ...} with fields named by their json tags, falling back to
+	// the field name. Fields tagged json:"-" are skipped, as are empty fields
+	// tagged omitempty. (Default: false, structs are formatted with %s)
+	StructUseJSONTags bool
+
+	// ValueFormats maps attribute keys, either the plain key or the dotted key
+	// with its groups, to a fmt format such as "%x" or "%.2f" used to write
+	// their values
+	ValueFormats map[string]string
+
+	// BytesFormat sets how []byte values are written (Default: BytesString)
+	BytesFormat BytesFormat
+
+	// HexDumpMaxLen is the longest byte slice BytesHexDump writes in full,
+	// longer slices are cut to half as many bytes from both the head and the
+	// tail (Default: 16)
+	HexDumpMaxLen int
+
+	// MaskFunc maps attribute keys, either the plain key or the dotted key
+	// with its groups, to a function that masks their values, e.g. to turn
+	// jane@example.com into j***@e***.com. The function is passed the value
+	// formatted as a string.
+	MaskFunc map[string]func(string) string
+
+	// EmptyValueMarker is written in place of empty string values, e.g. "∅",
+	// to set them apart from missing attributes (Default: "", written as "")
+	EmptyValueMarker string
+
+	// CollapseWhitespace replaces runs of whitespace in string values, such as
+	// tabs and newlines in captured command output, with a single space
+	// (Default: false)
+	CollapseWhitespace bool
+
+	// ValidateUTF8 replaces invalid UTF-8 in attribute keys and values with
+	// U+FFFD, so binary data can't corrupt the output (Default: false)
+	ValidateUTF8 bool
+
+	// KeyValueSeparator is written between each attribute key and its value,
+	// e.g. ": " or " => " for parsers that expect them. Keys are quoted the
+	// same way whatever the separator. (Default: "=")
+	KeyValueSeparator string
+
+	// KeyColor is the color, an ANSI escape sequence such as "\033[36m", of
+	// attribute keys and their "=" separator (Default: "", keys are faint)
+	KeyColor string
+
+	// ValueColors maps value kinds to the color, an ANSI escape sequence, of
+	// values of that kind, e.g. slog.KindInt64 to green. Only the value is
+	// colored. HashColorKeys, DurationColorThresholds and GroupColors take
+	// precedence. (Default: nil)
+	ValueColors map[slog.Kind]string
+
+	// GroupColors maps group names, e.g. "http" or "http.request", to the
+	// color, an ANSI escape sequence, used for the keys and values of the
+	// attributes within that group. The most specific group wins.
+	GroupColors map[string]string
+
+	// HashColorKeys lists attribute keys whose values are colored based on a
+	// hash of the value, so equal values always share a color
+	HashColorKeys []string
+
+	// DurationColorThresholds colors duration values with the color of the
+	// largest threshold they reach, e.g. yellow at 1s and red at 5s
+	DurationColorThresholds []DurationThreshold
+
+	// DurationBudgetKeys maps attribute keys to a time budget. Duration values
+	// of those keys are followed by their percent of the budget, e.g.
+	// took="1.2s"(24%), in red when over budget.
+	DurationBudgetKeys map[string]time.Duration
+
+	// TraceContext extracts trace and span IDs, e.g. from an OpenTelemetry
+	// span, carried by the context passed to Handle. When it reports ok the
+	// IDs are added as trace_id and span_id attributes.
+	TraceContext func(ctx context.Context) (traceID, spanID string, ok bool)
+
+	// TrackErrorGap appends a since_last_error attribute to error level records
+	// with the time elapsed since the previous error (Default: false)
+	TrackErrorGap bool
+
+	// FoldCommonPrefix prints attributes that share a top level group
+	// once under an indented header line for that group, one attribute per
+	// line, instead of repeating the group prefix on each key (Default: false)
+	FoldCommonPrefix bool
+
+	// AttrStyle sets how attributes are written. AttrStyleQuery does not
+	// color attributes and ignores FoldCommonPrefix. (Default: AttrStyleLogfmt)
+	AttrStyle AttrStyle
+
+	// KeyEscape sets how equals signs and spaces in keys are written, for
+	// parsers that can't handle quoted keys (Default: KeyEscapeQuote)
+	KeyEscape KeyEscapeMode
+
+	// EmptyKeyHandling sets how attributes with an empty key are written
+	// (Default: EmptyKeyQuote)
+	EmptyKeyHandling EmptyKeyMode
+
+	// EmptyKeyName is the key written for EmptyKeyPlaceholder (Default: "_")
+	EmptyKeyName string
+
+	// ShortKeys omits the group prefix of attributes nested a single group deep
+	// when no other attribute in the record has the same key (Default: false)
+	ShortKeys bool
+
+	// SortGroups writes attributes grouped by their top level group, with the
+	// groups in alphabetical order after the ungrouped attributes. The order
+	// of attributes within a group is kept. (Default: false)
+	SortGroups bool
+
+	// PreferRecordAttrs drops an attribute added with WithAttrs when the record
+	// has an attribute with the same key, groups included, so the record's
+	// value wins, e.g. env=staging over a logger's env=prod (Default: false,
+	// both are written)
+	PreferRecordAttrs bool
+
+	// MaxAttrs limits the number of attributes written for a record, after
+	// ReplaceAttr has removed any. The rest are replaced by a marker such as
+	// …(+3 more). Attributes the handler adds itself, such as seq, trace IDs
+	// and runtime stats, are always written. (Default: 0, no limit)
+	MaxAttrs int
+
+	// ShowAttrCount appends the number of attributes written for the record,
+	// after ReplaceAttr has removed any, to the end of the line (Default: false)
+	ShowAttrCount bool
+
+	// SuppressEmpty skips writing records that format to an empty line, such
+	// as when ReplaceAttr removes every attribute (Default: false)
+	SuppressEmpty bool
+
+	// ErrorCards writes ERROR and higher records as a boxed card, with the
+	// time, level and message on the first row and each attribute on its own
+	// row, so failures stand out in a stream of single line records. The card
+	// is drawn with ASCII when color is off. On a terminal, or when
+	// TerminalWidth is set, rows too long for the width wrap onto more rows.
+	// (Default: false)
+	ErrorCards bool
+
+	// LineTransform is called with each formatted line, without its trailing
+	// newline, just before it is written. The returned bytes are written as-is
+	// followed by a newline. It runs on the hot path for every record and must
+	// not retain the passed slice.
+	LineTransform func(line []byte) []byte
+
+	// LogSummaryOnClose makes Close write the Summary line, e.g. "3 warnings,
+	// 1 error in 4.2s", as an INFO record before closing (Default: false)
+	LogSummaryOnClose bool
+
+	// OnRecord is called with the level of every record that is written, for
+	// example to count log volume by level. Records below the level threshold
+	// or suppressed by other options are not reported.
+	OnRecord func(level slog.Level)
+
+	// AddSequence appends a seq attribute numbering the records written by the
+	// handler and the handlers derived from it, starting at 1, so dropped
+	// lines can be detected. Lines are written in sequence order, even when
+	// logging from several goroutines. (Default: false)
+	AddSequence bool
+
+	// AddRuntimeStats appends the heap in use in MiB and the number of
+	// goroutines to every record as heap and goroutines attributes. The stats
+	// are sampled at most once per RuntimeStatsInterval. (Default: false)
+	AddRuntimeStats bool
+
+	// RuntimeStatsInterval is how often AddRuntimeStats samples the runtime
+	// (Default: 10s)
+	RuntimeStatsInterval time.Duration
+
+	// Clock returns the current time for time based options and for the
+	// records logged by the package helpers (Default: time.Now)
+	Clock func() time.Time
 }
 
 var defaultLevel = slog.LevelInfo
+
+// Column widths used by the Columnar option
+const (
+	columnarMessageWidth = 24
+	columnarValueWidth   = 8
+)
+
 var defaultTimeFormat = time.DateTime
 
+// defaultHexDumpMaxLen is the longest byte slice written in full as a hex dump
+const defaultHexDumpMaxLen = 16
+
+// Reserved TimeFormat keywords that write times as a number since the Unix
+// epoch instead of formatting them with a layout
+const (
+	TimeFormatUnix      = "unix"      // seconds
+	TimeFormatUnixMilli = "unixmilli" // milliseconds
+	TimeFormatUnixNano  = "unixnano"  // nanoseconds
+)
+
 type Handler struct {
 	h      slog.Handler
 	logger *log.Logger
 
-	attrsPrefix string
+	attrs       []field // resolved attributes added with WithAttrs
 	groupPrefix string
 	groups      []string
+	groupColumn bool
 
 	addSource   bool
+	sourceRoot  string
+	sourceBase  bool
+	srcFrames   int
 	level       slog.Leveler
-	replaceAttr func([]string, slog.Attr) slog.Attr
-	timeFormat  string
-	noColor     bool
+	levelWidth  int
+	levelPad    int // width levels are padded to when levelWidth is not set
+	syslogNames bool
+	numCustom   bool // custom levels are written as numbers
+	levelStyles []LevelStyle
+	levelColors map[slog.Level]string
+	levelLabels map[slog.Level]string
+	levelPrefix map[slog.Level]string
+	prefixPad   int // width of the widest level prefix
+	levelRender func(slog.Level, bool) string
+
+	messageWidth int
+	stripMsgANSI bool
+	valueWidth   int
+	replaceAttr  func([]string, slog.Attr) slog.Attr
+	timeFormat   string // guarded by mu
+	utc          bool
+	noTime       bool
+	noColor      bool
+	keyColor     cliColor
+	kvSep        string
+	tty          bool
+	termWidth    int
+	wholeLine    bool
+	errorType    bool
+	jsonTags     bool
+	mlDelims     [2]string
+	validUTF8    bool
+	collapseWS   bool
+	preferRecord bool
+	emptyMarker  string
+	hashKeys     map[string]bool
+	groupColors  map[string]string
+	kindColors   map[slog.Kind]string
+	maskFuncs    map[string]func(string) string
+	valueFormats map[string]string
+	bytesFormat  BytesFormat
+	hexDumpMax   int
+	durColors    []DurationThreshold // sorted by At, largest first
+	durBudgets   map[string]time.Duration
+
+	thousandsSep rune
+
+	attrStyle     AttrStyle
+	keyEscape     KeyEscapeMode
+	emptyKeyMode  EmptyKeyMode
+	emptyKeyName  string
+	shortKeys     bool
+	foldPrefix    bool
+	showAttrCount bool
+	maxAttrs      int
+	sortGroups    bool
+	suppressEmpty bool
+	errorCards    bool
+	closeSummary  bool
+
+	mu sync.RWMutex
+
+	writeMu       *sync.Mutex  // shared by clones, so each record is written whole
+	audit         slog.Handler // set by WithAuditSink
+	auditLevel    slog.Level
+	auditOps      []auditOp // raw WithAttrs and WithGroup calls, for WithAuditSink
+	errorGap      *errorGap
+	runtimeStats  *runtimeStats
+	counts        *recordCounts
+	seq           *atomic.Uint64
+	traceIDs      func(context.Context) (string, string, bool)
+	ctxLineColor  func(context.Context) (string, bool)
+	onRecord      func(slog.Level)
+	lineTransform func([]byte) []byte
+	now           func() time.Time
+}
+
+// errorGap tracks the time of the last error record, it is shared between a
+// handler and all of its clones
+type errorGap struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// since records t as the latest error time and returns the time elapsed since
+// the previous error. ok is false if there was no previous error.
+func (g *errorGap) since(t time.Time) (d time.Duration, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.last.IsZero() {
+		d, ok = t.Sub(g.last), true
+	}
+	g.last = t
+	return d, ok
+}
+
+// defaultRuntimeStatsInterval is how often runtime stats are sampled when
+// RuntimeStatsInterval is not set
+const defaultRuntimeStatsInterval = 10 * time.Second
+
+// runtimeStats caches samples of the runtime memory and goroutine stats, it is
+// shared between a handler and all of its clones
+type runtimeStats struct {
+	mu         sync.Mutex
+	interval   time.Duration
+	next       time.Time
+	heapMiB    float64
+	goroutines int
+}
+
+// sample returns the latest stats, reading them from the runtime if the
+// interval has passed since the last sample
+func (s *runtimeStats) sample(t time.Time) (heapMiB float64, goroutines int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !t.Before(s.next) {
+		s.heapMiB, s.goroutines = readRuntimeStats()
+		s.next = t.Add(s.interval)
+	}
+	return s.heapMiB, s.goroutines
+}
+
+// readRuntimeStats reads the heap size in MiB, to one decimal place, and the
+// number of goroutines from the runtime
+var readRuntimeStats = func() (heapMiB float64, goroutines int) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return math.Round(float64(m.HeapAlloc)/(1<<20)*10) / 10, runtime.NumGoroutine()
+}
+
+// recordCounts counts the records written by level band since start, it is
+// shared between a handler and all of its clones
+type recordCounts struct {
+	start                      time.Time
+	debugs, infos, warns, errs atomic.Int64
+}
+
+// add counts a record written at level
+func (c *recordCounts) add(level slog.Level) {
+	switch levelBand(level) {
+	case slog.LevelDebug:
+		c.debugs.Add(1)
+	case slog.LevelInfo:
+		c.infos.Add(1)
+	case slog.LevelWarn:
+		c.warns.Add(1)
+	default:
+		c.errs.Add(1)
+	}
 }
 
 func NewHandler(w io.Writer, opts *HandlerOptions) slog.Handler {
+	isTTY := isTerminal(w)
 	f, hasFd := w.(*os.File)
 	if hasFd {
 		w = colorable.NewColorable(f)
@@ -135,6 +682,16 @@ func NewHandler(w io.Writer, opts *HandlerOptions) slog.Handler {
 	if opts == nil {
 		opts = &HandlerOptions{}
 	}
+	_, isLogFile := w.(*RotatingWriter)
+	color := resolveColor(colorInputs{
+		noColor:    opts.NoColor,
+		forceColor: opts.ForceColor,
+		forceEnv:   os.Getenv("FORCE_COLOR"),
+		noColorEnv: os.Getenv("NO_COLOR"),
+		term:       os.Getenv("TERM"),
+		logFile:    isLogFile,
+		tty:        opts.ForceTTY || isTTY,
+	})
 	h := &Handler{
 		h: slog.NewTextHandler(w, &slog.HandlerOptions{
 			AddSource:   opts.AddSource,
@@ -143,18 +700,148 @@ func NewHandler(w io.Writer, opts *HandlerOptions) slog.Handler {
 		}),
 		logger:      log.New(w, "", 0),
 		addSource:   opts.AddSource,
+		sourceRoot:  opts.SourceModuleRoot,
+		sourceBase:  opts.SourceBasenameOnly,
+		srcFrames:   opts.SourceFrames,
+		groupColumn: opts.GroupPathColumn,
 		level:       defaultLevel,
-		replaceAttr: opts.ReplaceAttr,
-		timeFormat:  defaultTimeFormat,
-		noColor:     opts.NoColor,
+		levelWidth:  opts.LevelWidth,
+		levelPad:    defaultLevelWidth,
+		syslogNames: opts.SyslogLevelNames,
+		numCustom:   opts.NameStandardOnly,
+		levelStyles: slices.Clone(opts.CustomLevelColors),
+		levelColors: opts.LevelColors,
+		levelLabels: opts.LevelLabels,
+		levelPrefix: opts.LevelPrefixes,
+		levelRender: opts.LevelRenderer,
+
+		messageWidth: opts.MessageWidth,
+		stripMsgANSI: opts.StripMessageANSI,
+		valueWidth:   opts.ValueWidth,
+		replaceAttr:  opts.ReplaceAttr,
+		timeFormat:   defaultTimeFormat,
+		utc:          opts.UTC,
+		noTime:       opts.DisableTime,
+		wholeLine:    opts.ColorWholeLine,
+		errorType:    opts.ErrorWithType,
+		jsonTags:     opts.StructUseJSONTags,
+		mlDelims:     opts.MultilineDelimiters,
+		validUTF8:    opts.ValidateUTF8,
+		collapseWS:   opts.CollapseWhitespace,
+		preferRecord: opts.PreferRecordAttrs,
+		emptyMarker:  opts.EmptyValueMarker,
+		noColor:      !color,
+		keyColor:     cliColor(opts.KeyColor),
+		kvSep:        cmp.Or(opts.KeyValueSeparator, "="),
+		tty:          opts.ForceTTY || isTTY,
+		termWidth:    opts.TerminalWidth,
+		groupColors:  opts.GroupColors,
+		kindColors:   opts.ValueColors,
+		maskFuncs:    opts.MaskFunc,
+		valueFormats: opts.ValueFormats,
+		bytesFormat:  opts.BytesFormat,
+		hexDumpMax:   cmp.Or(opts.HexDumpMaxLen, defaultHexDumpMaxLen),
+		durBudgets:   opts.DurationBudgetKeys,
+		now:          func() time.Time { return clock() },
+
+		attrStyle:     opts.AttrStyle,
+		keyEscape:     opts.KeyEscape,
+		emptyKeyMode:  opts.EmptyKeyHandling,
+		emptyKeyName:  opts.EmptyKeyName,
+		shortKeys:     opts.ShortKeys,
+		foldPrefix:    opts.FoldCommonPrefix,
+		showAttrCount: opts.ShowAttrCount,
+		maxAttrs:      opts.MaxAttrs,
+		sortGroups:    opts.SortGroups,
+		suppressEmpty: opts.SuppressEmpty,
+		errorCards:    opts.ErrorCards,
+		closeSummary:  opts.LogSummaryOnClose,
+		lineTransform: opts.LineTransform,
+		traceIDs:      opts.TraceContext,
+		ctxLineColor:  opts.LineColorFromContext,
+		onRecord:      opts.OnRecord,
+		writeMu:       &sync.Mutex{},
 	}
 
 	if opts.Level != nil {
 		h.level = opts.Level
 	}
+	if opts.LevelEnvVar != "" {
+		if env, ok := os.LookupEnv(opts.LevelEnvVar); ok {
+			if level, err := ParseLevel(env); err == nil {
+				h.level = level
+			}
+		}
+	}
 	if opts.TimeFormat != "" {
 		h.timeFormat = opts.TimeFormat
 	}
+	if opts.SyslogLevelNames {
+		h.levelPad = syslogLevelWidth
+	}
+	if len(h.levelLabels) > 0 {
+		h.levelPad = 0
+		for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+			label, ok := h.levelLabels[level]
+			if !ok && h.syslogNames {
+				label = syslogLabel(level)
+			} else if !ok {
+				label = levelLabel(level)
+			}
+			h.levelPad = max(h.levelPad, visibleWidth(label))
+		}
+	}
+	for _, prefix := range h.levelPrefix {
+		h.prefixPad = max(h.prefixPad, visibleWidth(prefix))
+	}
+	for _, style := range h.levelStyles {
+		h.levelPad = max(h.levelPad, visibleWidth(style.Label))
+	}
+	if opts.Columnar {
+		if h.levelWidth == 0 {
+			h.levelWidth = h.levelPad
+		}
+		if h.messageWidth == 0 {
+			h.messageWidth = columnarMessageWidth
+		}
+		if h.valueWidth == 0 {
+			h.valueWidth = columnarValueWidth
+		}
+	}
+	if opts.TrackErrorGap {
+		h.errorGap = &errorGap{}
+	}
+	if opts.AddSequence {
+		h.seq = &atomic.Uint64{}
+	}
+	if opts.AddRuntimeStats {
+		h.runtimeStats = &runtimeStats{interval: cmp.Or(opts.RuntimeStatsInterval, defaultRuntimeStatsInterval)}
+	}
+	if len(opts.DurationColorThresholds) > 0 {
+		h.durColors = slices.Clone(opts.DurationColorThresholds)
+		slices.SortFunc(h.durColors, func(a, b DurationThreshold) int {
+			return cmp.Compare(b.At, a.At)
+		})
+	}
+	if opts.ThousandsSeparator {
+		h.thousandsSep = ','
+		if opts.ThousandsSeparatorRune != 0 {
+			h.thousandsSep = opts.ThousandsSeparatorRune
+		}
+	}
+	if len(opts.HashColorKeys) > 0 {
+		h.hashKeys = make(map[string]bool, len(opts.HashColorKeys))
+		for _, key := range opts.HashColorKeys {
+			h.hashKeys[key] = true
+		}
+	}
+	if opts.Clock != nil {
+		h.now = opts.Clock
+	}
+	h.counts = &recordCounts{start: h.now()}
+	if h.emptyKeyName == "" {
+		h.emptyKeyName = "_"
+	}
 
 	return h
 }
@@ -162,15 +849,146 @@ func NewHandler(w io.Writer, opts *HandlerOptions) slog.Handler {
 func (h *Handler) clone() *Handler {
 	return &Handler{
 		logger:      log.New(h.logger.Writer(), "", 0),
-		attrsPrefix: h.attrsPrefix,
+		attrs:       h.attrs,
 		groupPrefix: h.groupPrefix,
 		groups:      h.groups,
+		groupColumn: h.groupColumn,
 		addSource:   h.addSource,
+		sourceRoot:  h.sourceRoot,
+		sourceBase:  h.sourceBase,
+		srcFrames:   h.srcFrames,
 		level:       h.level,
-		replaceAttr: h.replaceAttr,
-		timeFormat:  h.timeFormat,
-		noColor:     h.noColor,
+		levelWidth:  h.levelWidth,
+		levelPad:    h.levelPad,
+		syslogNames: h.syslogNames,
+		numCustom:   h.numCustom,
+		levelStyles: h.levelStyles,
+		levelColors: h.levelColors,
+		levelLabels: h.levelLabels,
+		levelPrefix: h.levelPrefix,
+		prefixPad:   h.prefixPad,
+		levelRender: h.levelRender,
+
+		messageWidth: h.messageWidth,
+		stripMsgANSI: h.stripMsgANSI,
+		valueWidth:   h.valueWidth,
+		replaceAttr:  h.replaceAttr,
+		timeFormat:   h.timeLayout(),
+		utc:          h.utc,
+		noTime:       h.noTime,
+		wholeLine:    h.wholeLine,
+		errorType:    h.errorType,
+		jsonTags:     h.jsonTags,
+		mlDelims:     h.mlDelims,
+		validUTF8:    h.validUTF8,
+		collapseWS:   h.collapseWS,
+		preferRecord: h.preferRecord,
+		emptyMarker:  h.emptyMarker,
+		noColor:      h.noColor,
+		keyColor:     h.keyColor,
+		kvSep:        h.kvSep,
+		tty:          h.tty,
+		termWidth:    h.termWidth,
+		hashKeys:     h.hashKeys,
+		groupColors:  h.groupColors,
+		kindColors:   h.kindColors,
+		maskFuncs:    h.maskFuncs,
+		valueFormats: h.valueFormats,
+		bytesFormat:  h.bytesFormat,
+		hexDumpMax:   h.hexDumpMax,
+		durColors:    h.durColors,
+		durBudgets:   h.durBudgets,
+
+		thousandsSep: h.thousandsSep,
+		audit:        h.audit,
+		auditLevel:   h.auditLevel,
+		auditOps:     h.auditOps,
+		writeMu:      h.writeMu,
+		errorGap:     h.errorGap,
+		runtimeStats: h.runtimeStats,
+		counts:       h.counts,
+		seq:          h.seq,
+		now:          h.now,
+
+		attrStyle:     h.attrStyle,
+		keyEscape:     h.keyEscape,
+		emptyKeyMode:  h.emptyKeyMode,
+		emptyKeyName:  h.emptyKeyName,
+		shortKeys:     h.shortKeys,
+		foldPrefix:    h.foldPrefix,
+		showAttrCount: h.showAttrCount,
+		maxAttrs:      h.maxAttrs,
+		sortGroups:    h.sortGroups,
+		suppressEmpty: h.suppressEmpty,
+		errorCards:    h.errorCards,
+		closeSummary:  h.closeSummary,
+		lineTransform: h.lineTransform,
+		traceIDs:      h.traceIDs,
+		ctxLineColor:  h.ctxLineColor,
+		onRecord:      h.onRecord,
+	}
+}
+
+// FlushableWriter is a writer that buffers output until it is flushed, such
+// as a gzip.Writer or a bufio.Writer
+type FlushableWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// Summary returns a one line summary of the records written by the handler
+// and its clones and the time since it was created, e.g. "3 warnings, 1 error
+// in 4.2s", for the end of a command's output
+func (h *Handler) Summary() string {
+	elapsed := h.now().Sub(h.counts.start)
+	if elapsed < time.Second {
+		elapsed = elapsed.Round(time.Millisecond)
+	} else {
+		elapsed = elapsed.Round(100 * time.Millisecond)
+	}
+	return plural(h.counts.warns.Load(), "warning") + ", " +
+		plural(h.counts.errs.Load(), "error") + " in " + elapsed.String()
+}
+
+// plural returns n followed by word, with an s unless n is 1
+func plural(n int64, word string) string {
+	s := strconv.FormatInt(n, 10) + " " + word
+	if n != 1 {
+		s += "s"
+	}
+	return s
+}
+
+// Close flushes the handler's writer if it is a FlushableWriter and then
+// closes it if it is an io.Closer, so buffered or compressed output such as a
+// gzip.Writer is complete. Standard output and standard error are never
+// closed. Handlers derived with WithAttrs or WithGroup share the writer, so
+// none of them should be used after Close. With LogSummaryOnClose the Summary
+// is logged first.
+func (h *Handler) Close() error {
+	if h.closeSummary {
+		r := slog.NewRecord(h.now(), slog.LevelInfo, h.Summary(), 0)
+		if err := h.Handle(context.Background(), r); err != nil {
+			return err
+		}
+	}
+	// hold the write lock so a record logged through a clone at the same time
+	// is not written into a writer being flushed or closed
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+	w := h.logger.Writer()
+	if f, ok := w.(FlushableWriter); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	if w == os.Stdout || w == os.Stderr {
+		return nil
 	}
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
 }
 
 func SetAsDefault(w io.Writer, opts *HandlerOptions) {
@@ -179,25 +997,185 @@ func SetAsDefault(w io.Writer, opts *HandlerOptions) {
 	slog.SetDefault(logger)
 }
 
+// ReconfigureDefault builds a new handler and installs it as the default
+// logger, replacing the one installed by SetAsDefault. It is safe to call while
+// other goroutines log through slog.Default(); each record goes entirely to
+// either the old or the new handler. Loggers derived from the old default with
+// With keep writing to the old handler.
+func ReconfigureDefault(w io.Writer, opts *HandlerOptions) {
+	// slog.SetDefault swaps the default logger atomically
+	SetAsDefault(w, opts)
+}
+
+// ColorEnabled reports whether the handler writes ANSI color codes, after
+// weighing all of the color options and the environment
+func (h *Handler) ColorEnabled() bool {
+	return !h.colorOff()
+}
+
+// width returns the width in columns of the terminal the handler writes to
+func (h *Handler) width() int {
+	if h.termWidth > 0 {
+		return h.termWidth
+	}
+	return terminalWidth(h.logger.Writer())
+}
+
+// colorOff reports whether color codes are left out of the output
+func (h *Handler) colorOff() bool {
+	return h.noColor || globalNoColor.Load()
+}
+
+// DebugState describes the groups and attributes the handler has accumulated
+// through WithGroup and WithAttrs, for debugging logger configuration
+func (h *Handler) DebugState() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "groups: %q\n", h.groups)
+	fmt.Fprintf(&b, "group prefix: %q\n", h.groupPrefix)
+	fmt.Fprintf(&b, "attrs (%d):", len(h.attrs))
+
+	plain := h.clone()
+	plain.noColor = true
+	buf := newBuffer()
+	defer buf.Free()
+	for _, f := range h.attrs {
+		buf.WriteByte(' ')
+		plain.appendField(buf, f)
+	}
+	b.Write(*buf)
+	b.WriteByte('\n')
+	return b.String()
+}
+
 func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.audit != nil && level >= h.auditLevel {
+		return true
+	}
 	return level >= h.level.Level()
 }
 
+// auditOp is a WithAttrs or WithGroup call, kept so an audit sink attached
+// later receives the same attributes and groups as one attached first
+type auditOp struct {
+	group string
+	attrs []slog.Attr
+}
+
+// WithAuditSink returns a handler that additionally writes records at or above
+// minLevel to w as JSON, without color, regardless of the handler's own level.
+// The handler's own output is unchanged. Attributes and groups apply to both
+// outputs, whether they were added before or after the sink. The sink gets the
+// attributes as they were logged: ReplaceAttr, MaskFunc and the other options
+// that change the handler's output do not apply to it.
+func (h *Handler) WithAuditSink(w io.Writer, minLevel slog.Level) slog.Handler {
+	h2 := h.clone()
+	h2.audit = slog.NewJSONHandler(w, &slog.HandlerOptions{
+		AddSource: h.addSource,
+		Level:     minLevel,
+	})
+	for _, op := range h.auditOps {
+		if op.group != "" {
+			h2.audit = h2.audit.WithGroup(op.group)
+		} else {
+			h2.audit = h2.audit.WithAttrs(op.attrs)
+		}
+	}
+	h2.auditLevel = minLevel
+	return h2
+}
+
 func (h *Handler) SetLogLoggerLevel(level slog.Level) {
 	h.level = level
 }
 
+// SetTimeFormat changes the layout used to format record times. It is safe to
+// call while the handler is in use. Handlers previously derived with WithAttrs
+// or WithGroup keep the layout they were created with.
+func (h *Handler) SetTimeFormat(layout string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.timeFormat = layout
+}
+
+func (h *Handler) timeLayout() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.timeFormat
+}
+
 func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if h.audit != nil {
+		if r.Level >= h.auditLevel {
+			if err := h.audit.Handle(ctx, r.Clone()); err != nil {
+				return err
+			}
+		}
+		if r.Level < h.level.Level() {
+			return nil
+		}
+	}
+
+	buf := newBuffer()
+	defer buf.Free()
+
+	if !h.write(ctx, buf, r) {
+		return nil
+	}
+	h.counts.add(r.Level)
+	if h.onRecord != nil {
+		h.onRecord(r.Level)
+	}
+
+	return nil
+}
+
+// write formats r into buf and writes the line, reporting whether there was a
+// line to write. With AddSequence the write lock is also held while formatting,
+// where the sequence number is taken, so lines are written in sequence order.
+func (h *Handler) write(ctx context.Context, buf *buffer, r slog.Record) bool {
+	if h.seq != nil {
+		h.writeMu.Lock()
+		defer h.writeMu.Unlock()
+	}
+	line, ok := h.format(ctx, buf, r)
+	if !ok {
+		return false
+	}
+	if h.seq == nil {
+		h.writeMu.Lock()
+		defer h.writeMu.Unlock()
+	}
+	h.logger.Println(string(line))
+	return true
+}
+
+// FormatRecord formats r as the handler built from opts would write it,
+// without the trailing newline, e.g. to embed a log line in a report. It
+// returns "" if the record would not be written.
+func FormatRecord(opts *HandlerOptions, r slog.Record) string {
+	h := NewHandler(io.Discard, opts).(*Handler)
 	buf := newBuffer()
 	defer buf.Free()
+	line, ok := h.format(context.Background(), buf, r)
+	if !ok {
+		return ""
+	}
+	return string(line)
+}
 
+// format renders r into buf and returns the finished line without a trailing
+// newline. ok is false if nothing should be written for the record.
+func (h *Handler) format(ctx context.Context, buf *buffer, r slog.Record) (line []byte, ok bool) {
 	rep := h.replaceAttr
 
 	// time
-	if !r.Time.IsZero() {
+	if !r.Time.IsZero() && !h.noTime {
+		if h.utc {
+			r.Time = r.Time.UTC()
+		}
 		val := r.Time.Round(0) // strip monotonic to match Attr behavior
 		if rep == nil {
-			*buf = r.Time.AppendFormat(*buf, h.timeFormat)
+			h.appendTime(buf, r.Time)
 			buf.WriteByte(' ')
 		} else {
 			h.appendStd(buf, slog.Time(slog.TimeKey, val))
@@ -213,7 +1191,7 @@ func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
 	}
 
 	// source
-	if h.addSource {
+	if h.addSource && h.srcFrames <= 1 {
 		fs := runtime.CallersFrames([]uintptr{r.PC})
 		f, _ := fs.Next()
 		if f.File != "" {
@@ -232,81 +1210,372 @@ func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
 		}
 	}
 
+	// group path
+	if h.groupColumn && len(h.groups) > 0 {
+		h.appendGroupPath(buf)
+		buf.WriteByte(' ')
+	}
+
 	// message
 	if rep == nil {
-		buf.WriteString(r.Message)
-		buf.WriteByte(' ')
+		if r.Message != "" || h.messageWidth > 0 {
+			h.appendMessage(buf, r.Message)
+			buf.WriteByte(' ')
+		}
 	} else {
 		h.appendStd(buf, slog.String(slog.MessageKey, r.Message))
 	}
 
-	// handler attributes
-	if len(h.attrsPrefix) > 0 {
-		buf.WriteString(h.attrsPrefix)
-	}
-
-	// attributes
-	if r.NumAttrs() > 0 {
+	// handler and record attributes
+	var fields []field
+	if len(h.attrs) > 0 || r.NumAttrs() > 0 {
+		fields = make([]field, 0, len(h.attrs)+r.NumAttrs())
+		fields = append(fields, h.attrs...)
 		r.Attrs(func(attr slog.Attr) bool {
-			h.appendAttr(buf, attr, h.groupPrefix, h.groups)
+			fields = h.collectAttr(fields, attr, h.groupPrefix, h.groups)
 			return true
 		})
+		if h.preferRecord && len(h.attrs) > 0 {
+			fields = dropShadowed(fields, len(h.attrs))
+		}
 	}
 
-	h.logger.Println(strings.TrimRight(buf.String(), " "))
+	// MaxAttrs limits only the handler and record attributes, the fields the
+	// handler adds itself below are always written
+	var more int
+	if h.maxAttrs > 0 && len(fields) > h.maxAttrs {
+		more = len(fields) - h.maxAttrs
+		fields = fields[:h.maxAttrs]
+	}
 
-	return nil
-}
+	// source frames
+	if h.addSource && h.srcFrames > 1 {
+		for i, f := range callerFrames(r.PC, h.srcFrames) {
+			src := h.sourcePath(f.File) + ":" + strconv.Itoa(f.Line)
+			fields = h.collectAttr(fields, slog.String(strconv.Itoa(i), src), slog.SourceKey+".", []string{slog.SourceKey})
+		}
+	}
 
-func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	if len(attrs) == 0 {
-		return h
+	// trace
+	if h.traceIDs != nil {
+		if traceID, spanID, ok := h.traceIDs(ctx); ok {
+			fields = h.collectAttr(fields, slog.String("trace_id", traceID), "", nil)
+			fields = h.collectAttr(fields, slog.String("span_id", spanID), "", nil)
+		}
 	}
-	h2 := h.clone()
 
-	buf := newBuffer()
-	defer buf.Free()
+	// error gap
+	if h.errorGap != nil && r.Level >= slog.LevelError {
+		if d, ok := h.errorGap.since(h.now()); ok {
+			fields = h.collectAttr(fields, slog.Duration("since_last_error", d), "", nil)
+		} else {
+			fields = h.collectAttr(fields, slog.String("since_last_error", "never"), "", nil)
+		}
+	}
 
-	// write attributes to buffer
-	for _, attr := range attrs {
-		h2.appendAttr(buf, attr, h2.groupPrefix, h2.groups)
+	// runtime stats
+	if h.runtimeStats != nil {
+		heap, goroutines := h.runtimeStats.sample(h.now())
+		fields = h.collectAttr(fields, slog.Float64("heap", heap), "", nil)
+		fields = h.collectAttr(fields, slog.Int("goroutines", goroutines), "", nil)
 	}
-	h2.attrsPrefix = h.attrsPrefix + buf.String()
-	return h2
-}
 
-func (h *Handler) WithGroup(name string) slog.Handler {
-	if name == "" {
-		return h
+	// sequence
+	if h.seq != nil {
+		fields = h.collectAttr(fields, slog.Uint64("seq", h.seq.Add(1)), "", nil)
 	}
-	h2 := h.clone()
-	h2.groupPrefix += name + "."
-	h2.groups = append(h2.groups, name)
-	return h2
-}
 
-func (h *Handler) appendLevel(buf *buffer, level slog.Level) {
-	switch level {
-	case slog.LevelDebug:
-		h.appendANSI(buf, cliFgBlue)
-		buf.WriteString("DEBUG")
+	if len(h.maskFuncs) > 0 {
+		for i, f := range fields {
+			fields[i].attr = h.mask(f)
+		}
+	}
+
+	if h.groupColumn && h.groupPrefix != "" {
+		for i, f := range fields {
+			fields[i].prefix = strings.TrimPrefix(f.prefix, h.groupPrefix)
+		}
+	}
+
+	if h.sortGroups {
+		slices.SortStableFunc(fields, func(a, b field) int {
+			return strings.Compare(topGroup(a), topGroup(b))
+		})
+	}
+
+	if h.shortKeys {
+		shortenKeys(fields)
+	}
+
+	card := h.errorCards && r.Level >= slog.LevelError
+	var folds []fold
+	if card {
+		h.appendCard(buf, fields, more)
+	} else if h.attrStyle == AttrStyleQuery {
+		h.appendQuery(buf, fields)
+	} else {
+		if h.foldPrefix {
+			fields, folds = foldFields(fields)
+		}
+		for _, f := range fields {
+			h.appendField(buf, f)
+			buf.WriteByte(' ')
+		}
+	}
+	if more > 0 && !card {
+		h.appendANSI(buf, cliFaint)
+		buf.WriteString("…(+")
+		buf.WritePosInt(more)
+		buf.WriteString(" more)")
 		h.appendANSI(buf, cliReset)
-	case slog.LevelInfo:
-		buf.WriteString(" INFO")
-	case slog.LevelWarn:
-		h.appendANSI(buf, cliFgYellow)
-		buf.WriteString(" WARN")
+		buf.WriteByte(' ')
+	}
+	if h.showAttrCount && !card {
+		count := len(fields)
+		for _, fd := range folds {
+			count += len(fd.fields)
+		}
+		h.appendAttrCount(buf, count)
+	}
+	*buf = bytes.TrimRight(*buf, " \n")
+	h.appendFolds(buf, folds)
+	if h.suppressEmpty && len(*buf) == 0 {
+		return nil, false
+	}
+
+	if !h.colorOff() && !card {
+		if color := h.lineColor(ctx, r.Level); color != "" {
+			*buf = colorLine(*buf, color)
+		}
+	}
+
+	line = []byte(*buf)
+	if h.lineTransform != nil {
+		line = h.lineTransform(line)
+	}
+	return line, true
+}
+
+// cardBorder holds the characters used to draw an error card
+type cardBorder struct {
+	topLeft, topRight, bottomLeft, bottomRight string
+	left, right, horizontal, vertical          string
+}
+
+var (
+	boxBorder   = cardBorder{"┌", "┐", "└", "┘", "├", "┤", "─", "│"}
+	asciiBorder = cardBorder{"+", "+", "+", "+", "+", "+", "-", "|"}
+)
+
+// appendCard replaces the header already in buf, the time, level and message,
+// with a card holding the header and a row for each field
+func (h *Handler) appendCard(buf *buffer, fields []field, more int) {
+	rows := []string{string(bytes.TrimRight(*buf, " "))}
+	row := newBuffer()
+	defer row.Free()
+	for _, f := range fields {
+		row.Reset()
+		h.appendField(row, f)
+		rows = append(rows, string(*row))
+	}
+	if more > 0 {
+		rows = append(rows, fmt.Sprintf("…(+%d more)", more))
+	}
+
+	width := 0
+	for _, r := range rows {
+		width = max(width, visibleWidth(r))
+	}
+	// only a terminal limits the width, leaving room for the borders and the
+	// space inside them; files and pipes keep every row whole
+	if h.tty || h.termWidth > 0 {
+		width = max(min(width, h.width()-4), 1)
+	}
+	header := 1
+	if width < visibleWidth(rows[0]) {
+		header = len(wrapWidth(stripANSI(rows[0]), width))
+	}
+
+	border := boxBorder
+	if h.colorOff() {
+		border = asciiBorder
+	}
+	rule := func(left, right string) {
+		h.appendANSI(buf, cliFgRed)
+		buf.WriteString(left)
+		buf.WriteString(strings.Repeat(border.horizontal, width+2))
+		buf.WriteString(right)
 		h.appendANSI(buf, cliReset)
-	case slog.LevelError:
+	}
+
+	buf.Reset()
+	rule(border.topLeft, border.topRight)
+	lines := make([]string, 0, len(rows))
+	for _, r := range rows {
+		if visibleWidth(r) > width {
+			lines = append(lines, wrapWidth(stripANSI(r), width)...)
+		} else {
+			lines = append(lines, r)
+		}
+	}
+	for i, r := range lines {
+		if i == header {
+			buf.WriteByte('\n')
+			rule(border.left, border.right)
+		}
+		buf.WriteByte('\n')
 		h.appendANSI(buf, cliFgRed)
-		buf.WriteString("ERROR")
+		buf.WriteString(border.vertical)
 		h.appendANSI(buf, cliReset)
+		buf.WriteByte(' ')
+		buf.WriteString(r)
+		buf.WriteString(strings.Repeat(" ", max(width-visibleWidth(r), 0)+1))
+		h.appendANSI(buf, cliFgRed)
+		buf.WriteString(border.vertical)
+		h.appendANSI(buf, cliReset)
+	}
+	buf.WriteByte('\n')
+	rule(border.bottomLeft, border.bottomRight)
+}
+
+// lineColor returns the color for the whole line of a record, or "" for none
+func (h *Handler) lineColor(ctx context.Context, level slog.Level) cliColor {
+	if h.ctxLineColor != nil {
+		if color, ok := h.ctxLineColor(ctx); ok {
+			return cliColor(color)
+		}
+	}
+	if h.wholeLine {
+		band := levelBand(level)
+		if c, ok := h.levelColors[band]; ok {
+			return cliColor(c)
+		}
+		return levelColor(band)
+	}
+	return ""
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := h.clone()
+
+	// resolve the attributes now so ReplaceAttr is called once per attribute,
+	// they are rendered along with the record attributes in Handle
+	fields := slices.Clip(h.attrs)
+	for _, attr := range attrs {
+		fields = h2.collectAttr(fields, attr, h2.groupPrefix, h2.groups)
+	}
+	h2.attrs = fields
+	h2.auditOps = append(slices.Clip(h.auditOps), auditOp{attrs: attrs})
+	if h2.audit != nil {
+		h2.audit = h2.audit.WithAttrs(attrs)
+	}
+	return h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := h.clone()
+	h2.groupPrefix += name + "."
+	h2.groups = append(h2.groups, name)
+	h2.auditOps = append(slices.Clip(h.auditOps), auditOp{group: name})
+	if h2.audit != nil {
+		h2.audit = h2.audit.WithGroup(name)
+	}
+	return h2
+}
+
+func (h *Handler) appendLevel(buf *buffer, level slog.Level) {
+	if h.prefixPad > 0 {
+		prefix := h.levelPrefix[level]
+		buf.WriteString(prefix)
+		for n := visibleWidth(prefix); n < h.prefixPad; n++ {
+			buf.WriteByte(' ')
+		}
+	}
+	if h.levelRender != nil {
+		buf.WriteString(h.levelRender(level, h.colorOff()))
+		return
+	}
+	buf.WriteString(h.renderLevel(level, h.colorOff()))
+}
+
+// renderLevel is the built-in level rendering: the padded level label wrapped
+// in the level color unless noColor is set
+func (h *Handler) renderLevel(level slog.Level, noColor bool) string {
+	// levels between the standard ones take the color of the band they fall
+	// in, including a LevelColors override for it
+	label := levelLabel(level)
+	band := levelBand(level)
+	color := levelColor(band)
+	if c, ok := h.levelColors[band]; ok {
+		color = cliColor(c)
+	}
+	if h.syslogNames {
+		label = syslogLabel(level)
+	} else if h.numCustom && band != level {
+		label = strconv.Itoa(int(level))
+	}
+	if style, ok := matchLevelStyle(h.levelStyles, level); ok {
+		if style.Label != "" {
+			label = style.Label
+		}
+		if style.Color != "" {
+			color = cliColor(style.Color)
+		}
+	}
+	if c, ok := h.levelColors[level]; ok {
+		color = cliColor(c)
+	}
+	if l, ok := h.levelLabels[level]; ok {
+		label = l
+	}
+
+	width := h.levelPad
+	if h.levelWidth > 0 {
+		width = h.levelWidth
+		label = truncateWidth(label, width)
+	}
+	label = padLeft(label, width)
+
+	if color == "" || noColor {
+		return label
+	}
+	return string(color) + label + string(cliReset)
+}
+
+// appendTime writes t in the handler's time format
+func (h *Handler) appendTime(buf *buffer, t time.Time) {
+	if !h.appendEpoch(buf, t) {
+		*buf = t.AppendFormat(*buf, h.timeLayout())
+	}
+}
+
+// appendEpoch writes t as a Unix epoch number when the time format is one of
+// the epoch keywords and reports whether it did
+func (h *Handler) appendEpoch(buf *buffer, t time.Time) bool {
+	switch h.timeLayout() {
+	case TimeFormatUnix:
+		*buf = strconv.AppendInt(*buf, t.Unix(), 10)
+	case TimeFormatUnixMilli:
+		*buf = strconv.AppendInt(*buf, t.UnixMilli(), 10)
+	case TimeFormatUnixNano:
+		*buf = strconv.AppendInt(*buf, t.UnixNano(), 10)
 	default:
-		buf.WriteString(level.String())
+		return false
 	}
+	return true
 }
 
+// appendStd writes one of the built-in attributes, attr.Key is the built-in
+// key. Built-ins are recognized by the key they started with, so they keep
+// their position and styling when ReplaceAttr renames them.
 func (h *Handler) appendStd(buf *buffer, attr slog.Attr) {
+	builtin := attr.Key
 	if h.replaceAttr != nil {
 		attr = h.replaceAttr(nil, attr)
 	}
@@ -315,23 +1584,63 @@ func (h *Handler) appendStd(buf *buffer, attr slog.Attr) {
 		return
 	}
 
-	key := strings.ToLower(attr.Key)
-	if key == slog.TimeKey {
-		buf.WriteString(attr.Value.Time().Format(h.timeFormat))
-		buf.WriteByte(' ')
-	} else if key == slog.LevelKey {
-		h.appendLevel(buf, attr.Value.Any().(slog.Level))
+	v := attr.Value.Resolve()
+	switch builtin {
+	case slog.TimeKey:
+		if v.Kind() == slog.KindTime {
+			h.appendTime(buf, v.Time())
+		} else {
+			buf.WriteString(v.String())
+		}
 		buf.WriteByte(' ')
-	} else if key == slog.SourceKey {
-		h.appendSource(buf, attr.Value.Any().(*slog.Source))
+	case slog.LevelKey:
+		if level, ok := v.Any().(slog.Level); ok {
+			h.appendLevel(buf, level)
+		} else {
+			buf.WriteString(v.String())
+		}
 		buf.WriteByte(' ')
-	} else if key == slog.MessageKey {
-		buf.WriteString(attr.Value.String())
+	case slog.SourceKey:
+		if src, ok := v.Any().(*slog.Source); ok {
+			h.appendSource(buf, src)
+		} else {
+			buf.WriteString(v.String())
+		}
 		buf.WriteByte(' ')
+	case slog.MessageKey:
+		if msg := v.String(); msg != "" || h.messageWidth > 0 {
+			h.appendMessage(buf, msg)
+			buf.WriteByte(' ')
+		}
 	}
 }
 
-func (h *Handler) appendAttr(buf *buffer, attr slog.Attr, groupsPrefix string, groups []string) {
+// field is a resolved, non-group attribute along with its group prefix
+type field struct {
+	prefix string
+	attr   slog.Attr
+}
+
+// dropShadowed removes the first n fields, the handler attributes, whose full
+// key is also used by one of the record fields after them
+func dropShadowed(fields []field, n int) []field {
+	keys := make(map[string]bool, len(fields)-n)
+	for _, f := range fields[n:] {
+		keys[f.prefix+f.attr.Key] = true
+	}
+	kept := fields[:0]
+	for i, f := range fields {
+		if i < n && keys[f.prefix+f.attr.Key] {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// collectAttr resolves attr, applies ReplaceAttr and flattens groups, appending
+// the resulting fields
+func (h *Handler) collectAttr(fields []field, attr slog.Attr, groupsPrefix string, groups []string) []field {
 	if h.replaceAttr != nil && attr.Value.Kind() != slog.KindGroup {
 		// Resolve before calling ReplaceAttr, so the user doesn't have to.
 		attr.Value = attr.Value.Resolve()
@@ -340,7 +1649,7 @@ func (h *Handler) appendAttr(buf *buffer, attr slog.Attr, groupsPrefix string, g
 	attr.Value = attr.Value.Resolve()
 
 	if attr.Equal(slog.Any("", nil)) {
-		return
+		return fields
 	}
 
 	if attr.Value.Kind() == slog.KindGroup {
@@ -349,90 +1658,706 @@ func (h *Handler) appendAttr(buf *buffer, attr slog.Attr, groupsPrefix string, g
 			groups = append(groups, attr.Key)
 		}
 		for _, groupAttr := range attr.Value.Group() {
-			h.appendAttr(buf, groupAttr, groupsPrefix, groups)
+			fields = h.collectAttr(fields, groupAttr, groupsPrefix, groups)
 		}
-	} else if err, ok := attr.Value.Any().(error); ok {
-		h.appendError(buf, err, attr.Key, groupsPrefix)
-		buf.WriteByte(' ')
+		return fields
+	}
+	if attr.Key == "" && h.emptyKeyMode == EmptyKeyDrop {
+		return fields
+	}
+	return append(fields, field{prefix: groupsPrefix, attr: attr})
+}
+
+func (h *Handler) appendField(buf *buffer, f field) {
+	attr := f.attr
+	if err, ok := attr.Value.Any().(error); ok {
+		h.appendError(buf, err, attr.Key, f.prefix)
 	} else {
-		h.appendKey(buf, attr.Key, groupsPrefix)
-		h.appendValue(buf, attr.Value)
+		h.appendKey(buf, attr.Key, f.prefix)
+		start := len(*buf)
+		color := h.valueColor(attr)
+		if color == "" {
+			color = h.groupColor(f.prefix)
+		}
+		if color == "" {
+			color = cliColor(h.kindColors[attr.Value.Kind()])
+		}
+		if color != "" {
+			h.appendANSI(buf, color)
+		}
+		if verb, ok := h.valueFormat(f); ok {
+			appendAutoQuote(buf, h.validText(fmt.Sprintf(verb, attr.Value.Any())))
+		} else {
+			h.appendValue(buf, attr.Value)
+		}
+		if color != "" {
+			h.appendANSI(buf, cliReset)
+		}
+		if budget, ok := h.durBudgets[attr.Key]; ok && budget > 0 && attr.Value.Kind() == slog.KindDuration {
+			h.appendBudget(buf, attr.Value.Duration(), budget)
+		}
+		if h.valueWidth > 0 {
+			padValue(buf, start, h.valueWidth, isNumber(attr.Value))
+		}
+	}
+}
+
+// valueFormat returns the ValueFormats verb for the dotted or plain key of f
+func (h *Handler) valueFormat(f field) (string, bool) {
+	if len(h.valueFormats) == 0 {
+		return "", false
+	}
+	if verb, ok := h.valueFormats[f.prefix+f.attr.Key]; ok {
+		return verb, true
+	}
+	verb, ok := h.valueFormats[f.attr.Key]
+	return verb, ok
+}
+
+// appendGroupPath writes the open handler groups as a column, e.g. [http.request]
+func (h *Handler) appendGroupPath(buf *buffer) {
+	h.appendANSI(buf, cliFaint)
+	buf.WriteByte('[')
+	buf.WriteString(strings.Join(h.groups, "."))
+	buf.WriteByte(']')
+	h.appendANSI(buf, cliReset)
+}
+
+// appendQuery writes fields as a URL query string followed by a space
+func (h *Handler) appendQuery(buf *buffer, fields []field) {
+	for i, f := range fields {
+		if i == 0 {
+			buf.WriteByte('?')
+		} else {
+			buf.WriteByte('&')
+		}
+		key := f.attr.Key
+		if key == "" && h.emptyKeyMode == EmptyKeyPlaceholder {
+			key = h.emptyKeyName
+		}
+		buf.WriteString(url.QueryEscape(f.prefix + key))
+		buf.WriteByte('=')
+		buf.WriteString(url.QueryEscape(f.attr.Value.String()))
+	}
+	if len(fields) > 0 {
 		buf.WriteByte(' ')
 	}
 }
 
-func (h *Handler) appendKey(buf *buffer, key, groups string) {
+// appendBudget writes d as a percent of budget, e.g. (24%), in red when d is
+// over budget
+func (h *Handler) appendBudget(buf *buffer, d, budget time.Duration) {
+	percent := int(math.Round(float64(d) / float64(budget) * 100))
+	if d > budget {
+		h.appendANSI(buf, cliFgRed)
+	}
+	buf.WriteByte('(')
+	*buf = strconv.AppendInt(*buf, int64(percent), 10)
+	buf.WriteString("%)")
+	if d > budget {
+		h.appendANSI(buf, cliReset)
+	}
+}
+
+// mask returns the attribute of f with its value masked by the MaskFunc for
+// its dotted or plain key, if there is one
+func (h *Handler) mask(f field) slog.Attr {
+	fn, ok := h.maskFuncs[f.prefix+f.attr.Key]
+	if !ok {
+		fn, ok = h.maskFuncs[f.attr.Key]
+	}
+	if !ok || fn == nil {
+		return f.attr
+	}
+	return slog.String(f.attr.Key, fn(f.attr.Value.String()))
+}
+
+// appendMessage writes the record message, padded to the message width
+func (h *Handler) appendMessage(buf *buffer, msg string) {
+	if h.stripMsgANSI {
+		msg = stripANSI(msg)
+	}
+	buf.WriteString(msg)
+	for n := visibleWidth(msg); n < h.messageWidth; n++ {
+		buf.WriteByte(' ')
+	}
+}
+
+// padValue pads the value written to buf from start to width columns, on the
+// left to right align it or else on the right
+func padValue(buf *buffer, start, width int, right bool) {
+	n := width - visibleWidth(string((*buf)[start:]))
+	if n <= 0 {
+		return
+	}
+	pad := bytes.Repeat([]byte{' '}, n)
+	if right {
+		*buf = slices.Insert(*buf, start, pad...)
+	} else {
+		*buf = append(*buf, pad...)
+	}
+}
+
+// isNumber reports whether v is a numeric value
+func isNumber(v slog.Value) bool {
+	switch v.Kind() {
+	case slog.KindInt64, slog.KindUint64, slog.KindFloat64:
+		return true
+	}
+	return false
+}
+
+// valueColor returns the color for the value of attr, or "" for none
+func (h *Handler) valueColor(attr slog.Attr) cliColor {
+	if h.hashKeys[attr.Key] {
+		return hashColor(attr.Value.String())
+	}
+	if attr.Value.Kind() == slog.KindDuration {
+		d := attr.Value.Duration()
+		for _, t := range h.durColors {
+			if d >= t.At {
+				return cliColor(t.Color)
+			}
+		}
+	}
+	return ""
+}
+
+// groupColor returns the color of the most specific group in the dotted group
+// prefix that has one in GroupColors, or "" for none
+func (h *Handler) groupColor(prefix string) cliColor {
+	if len(h.groupColors) == 0 {
+		return ""
+	}
+	group := strings.TrimSuffix(prefix, ".")
+	for group != "" {
+		if color, ok := h.groupColors[group]; ok {
+			return cliColor(color)
+		}
+		i := strings.LastIndexByte(group, '.')
+		if i < 0 {
+			break
+		}
+		group = group[:i]
+	}
+	return ""
+}
+
+// appendAttrCount writes the number of attributes in the record, e.g. (3 fields)
+func (h *Handler) appendAttrCount(buf *buffer, count int) {
 	h.appendANSI(buf, cliFaint)
-	if len(key) == 0 {
+	buf.WriteByte('(')
+	buf.WritePosInt(count)
+	if count == 1 {
+		buf.WriteString(" field)")
+	} else {
+		buf.WriteString(" fields)")
+	}
+	h.appendANSI(buf, cliReset)
+}
+
+// topGroup returns the name of the top level group of f, or "" if f is not in
+// a group
+func topGroup(f field) string {
+	name, _, _ := strings.Cut(f.prefix, ".")
+	return name
+}
+
+// shortenKeys drops the group prefix from fields nested a single group deep
+// when no other field shares the same key
+func shortenKeys(fields []field) {
+	counts := make(map[string]int, len(fields))
+	for _, f := range fields {
+		counts[f.attr.Key]++
+	}
+	for i, f := range fields {
+		if strings.Count(f.prefix, ".") == 1 && counts[f.attr.Key] == 1 {
+			fields[i].prefix = ""
+		}
+	}
+}
+
+// fold is a set of fields sharing the top level group name
+type fold struct {
+	name   string
+	fields []field
+}
+
+// foldFields moves fields that share a top level group with another field into
+// folds, in the order each group first appears. The group name is removed from
+// the prefix of folded fields.
+func foldFields(fields []field) (inline []field, folds []fold) {
+	counts := make(map[string]int)
+	for _, f := range fields {
+		if name, _, ok := strings.Cut(f.prefix, "."); ok {
+			counts[name]++
+		}
+	}
+
+	inline = fields[:0:0]
+	for _, f := range fields {
+		name, rest, ok := strings.Cut(f.prefix, ".")
+		if !ok || counts[name] < 2 {
+			inline = append(inline, f)
+			continue
+		}
+		f.prefix = rest
+		i := slices.IndexFunc(folds, func(fd fold) bool { return fd.name == name })
+		if i < 0 {
+			folds = append(folds, fold{name: name})
+			i = len(folds) - 1
+		}
+		folds[i].fields = append(folds[i].fields, f)
+	}
+	return inline, folds
+}
+
+// appendFolds writes each fold as an indented header line followed by its
+// fields, one per line
+func (h *Handler) appendFolds(buf *buffer, folds []fold) {
+	for _, fd := range folds {
+		buf.WriteString("\n  ")
+		h.appendANSI(buf, cliFaint)
+		appendAutoQuote(buf, fd.name)
+		buf.WriteByte(':')
+		h.appendANSI(buf, cliReset)
+		for _, f := range fd.fields {
+			buf.WriteString("\n    ")
+			h.appendField(buf, f)
+		}
+	}
+}
+
+func (h *Handler) appendKey(buf *buffer, key, groups string) {
+	if color := h.groupColor(groups); color != "" {
+		h.appendANSI(buf, color)
+	} else {
+		h.appendANSI(buf, cmp.Or(h.keyColor, cliFaint))
+	}
+	if len(key) == 0 && h.emptyKeyMode == EmptyKeyPlaceholder {
+		appendAutoQuote(buf, h.escapeKey(h.validText(groups+h.emptyKeyName)))
+	} else if len(key) == 0 {
 		buf.WriteString("\"\"")
 	} else {
-		appendAutoQuote(buf, groups+key) //TODO: simplify this
+		appendAutoQuote(buf, h.escapeKey(h.validText(groups+key))) //TODO: simplify this
 	}
-	buf.WriteByte('=')
+	buf.WriteString(h.kvSep)
 	h.appendANSI(buf, cliReset)
 }
 
+// escapeKey strips or replaces the equals signs and spaces in key as set by
+// the KeyEscape option
+func (h *Handler) escapeKey(key string) string {
+	if h.keyEscape == KeyEscapeQuote {
+		return key
+	}
+	return strings.Map(func(r rune) rune {
+		if r != '=' && !unicode.IsSpace(r) {
+			return r
+		}
+		if h.keyEscape == KeyEscapeReplace {
+			return '_'
+		}
+		return -1
+	}, key)
+}
+
 func (h *Handler) appendValue(buf *buffer, v slog.Value) {
 	switch v.Kind() {
 	case slog.KindString:
-		appendQuote(buf, v.String())
+		str := h.validText(v.String())
+		if h.collapseWS {
+			str = collapseSpace(str)
+		}
+		if str == "" && h.emptyMarker != "" {
+			buf.WriteString(h.emptyMarker)
+			break
+		}
+		appendQuote(buf, str)
 	case slog.KindInt64:
-		buf.Write(strconv.AppendInt(nil, v.Int64(), 10))
+		h.appendNumber(buf, strconv.AppendInt(nil, v.Int64(), 10))
 	case slog.KindUint64:
-		buf.Write(strconv.AppendUint(nil, v.Uint64(), 10))
+		h.appendNumber(buf, strconv.AppendUint(nil, v.Uint64(), 10))
 	case slog.KindFloat64:
-		buf.Write(strconv.AppendFloat(nil, v.Float64(), 'g', -1, 64))
+		h.appendNumber(buf, strconv.AppendFloat(nil, v.Float64(), 'g', -1, 64))
 	case slog.KindBool:
 		buf.Write(strconv.AppendBool(nil, v.Bool()))
 	case slog.KindDuration:
 		appendQuote(buf, v.Duration().String())
 	case slog.KindTime:
-		appendQuote(buf, v.Time().String())
+		if !h.appendEpoch(buf, v.Time()) {
+			appendQuote(buf, v.Time().Format(h.timeLayout()))
+		}
 	case slog.KindAny:
 		switch cv := v.Any().(type) {
 		case slog.Level:
 			buf.WriteString(v.String())
+		case multilineValue:
+			buf.WriteString(h.mlDelims[0])
+			for _, line := range strings.Split(h.validText(string(cv)), "\n") {
+				buf.WriteString("\n    ")
+				buf.WriteString(line)
+			}
+			if h.mlDelims[1] != "" {
+				buf.WriteString("\n    ")
+				buf.WriteString(h.mlDelims[1])
+			}
+			// end the value's last line so following attributes start a new one
+			buf.WriteByte('\n')
 		case encoding.TextMarshaler:
 			data, err := cv.MarshalText()
 			if err != nil {
 				break
 			}
-			appendQuote(buf, string(data))
+			appendQuote(buf, h.validText(string(data)))
 		case *slog.Source:
 			h.appendSource(buf, cv)
 		case []byte:
-			appendAutoQuote(buf, string(cv))
+			if h.bytesFormat == BytesHexDump {
+				h.appendHexDump(buf, cv)
+				break
+			}
+			appendAutoQuote(buf, h.validText(string(cv)))
 		default:
-			appendQuote(buf, fmt.Sprintf("%s", v.Any()))
+			if h.jsonTags {
+				if str, ok := structString(v.Any()); ok {
+					appendQuote(buf, h.validText(str))
+					break
+				}
+			}
+			appendQuote(buf, h.validText(fmt.Sprintf("%s", v.Any())))
+		}
+	}
+}
+
+// validText replaces invalid UTF-8 in s with U+FFFD when ValidateUTF8 is set
+func (h *Handler) validText(s string) string {
+	if h.validUTF8 {
+		return strings.ToValidUTF8(s, string(utf8.RuneError))
+	}
+	return s
+}
+
+// structString formats v, a struct or a pointer to one, as {name:value ...}
+// with fields named by their json tags. ok is false if v is not a struct or
+// formats itself, like a *url.URL or an error.
+func structString(v any) (s string, ok bool) {
+	rv, ok := fieldStruct(reflect.ValueOf(v))
+	if !ok {
+		return "", false
+	}
+	var b strings.Builder
+	writeStruct(&b, rv)
+	return b.String(), true
+}
+
+// fieldStruct follows the pointers in rv to a struct that does not format
+// itself. ok is false if there is none.
+func fieldStruct(rv reflect.Value) (reflect.Value, bool) {
+	for {
+		if formatsItself(rv) {
+			return rv, false
+		}
+		if rv.Kind() != reflect.Pointer || rv.IsNil() {
+			break
 		}
+		rv = rv.Elem()
 	}
+	return rv, rv.Kind() == reflect.Struct
+}
+
+// formatsItself reports whether rv is a fmt.Stringer, an error or an
+// encoding.TextMarshaler
+func formatsItself(rv reflect.Value) bool {
+	if !rv.IsValid() || !rv.CanInterface() {
+		return false
+	}
+	switch rv.Interface().(type) {
+	case fmt.Stringer, error, encoding.TextMarshaler:
+		return true
+	}
+	return false
+}
+
+func writeStruct(b *strings.Builder, rv reflect.Value) {
+	b.WriteByte('{')
+	written := 0
+	for i := 0; i < rv.NumField(); i++ {
+		sf := rv.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fv := rv.Field(i)
+		if slices.Contains(strings.Split(opts, ","), "omitempty") && isEmptyValue(fv) {
+			continue
+		}
+
+		if written > 0 {
+			b.WriteByte(' ')
+		}
+		written++
+		b.WriteString(name)
+		b.WriteByte(':')
+		// nested structs and pointers to them use their tags too, unless they
+		// format themselves like time.Time
+		if sv, ok := fieldStruct(fv); ok {
+			writeStruct(b, sv)
+		} else {
+			fmt.Fprintf(b, "%v", fv.Interface())
+		}
+	}
+	b.WriteByte('}')
+}
+
+// isEmptyValue reports whether v is empty as defined by the json omitempty
+// option
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// appendHexDump writes b as quoted, space separated hex pairs. Slices longer
+// than the hex dump limit are cut to their head and tail along with their
+// length, e.g. "00 01 … fe ff (len=256)".
+func (h *Handler) appendHexDump(buf *buffer, b []byte) {
+	const hex = "0123456789abcdef"
+	appendPairs := func(b []byte) {
+		for i, c := range b {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0x0f])
+		}
+	}
+
+	buf.WriteByte('"')
+	if len(b) <= h.hexDumpMax {
+		appendPairs(b)
+	} else {
+		half := max(h.hexDumpMax/2, 1)
+		appendPairs(b[:half])
+		buf.WriteString(" … ")
+		appendPairs(b[len(b)-half:])
+		buf.WriteString(" (len=")
+		buf.WritePosInt(len(b))
+		buf.WriteByte(')')
+	}
+	buf.WriteByte('"')
+}
+
+// collapseSpace replaces each run of whitespace in s with a single space
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// appendNumber writes a formatted number, grouping the digits of its integer
+// part when a thousands separator is configured. Numbers in scientific
+// notation are written unchanged.
+func (h *Handler) appendNumber(buf *buffer, num []byte) {
+	if h.thousandsSep == 0 || bytes.ContainsAny(num, "eE") {
+		buf.Write(num)
+		return
+	}
+
+	sign, digits := num[:0], num
+	if len(num) > 0 && num[0] == '-' {
+		sign, digits = num[:1], num[1:]
+	}
+	intPart, frac := digits, []byte(nil)
+	if i := bytes.IndexByte(digits, '.'); i >= 0 {
+		intPart, frac = digits[:i], digits[i:]
+	}
+
+	buf.Write(sign)
+	for i, d := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			*buf = utf8.AppendRune(*buf, h.thousandsSep)
+		}
+		buf.WriteByte(d)
+	}
+	buf.Write(frac)
 }
 
 func (h *Handler) appendError(buf *buffer, err error, attrKey, groupsPrefix string) {
 	h.appendANSI(buf, cliFaint)
 	h.appendANSI(buf, cliFgRed)
-	appendAutoQuote(buf, groupsPrefix+attrKey)
-	buf.WriteByte('=')
+	appendAutoQuote(buf, h.escapeKey(h.validText(groupsPrefix+attrKey)))
+	buf.WriteString(h.kvSep)
 	h.appendANSI(buf, cliReset)
-	appendQuote(buf, err.Error())
+	appendQuote(buf, h.validText(errorText(err)))
+	if h.errorType {
+		buf.WriteByte(' ')
+		h.appendANSI(buf, cliFaint)
+		buf.WriteString("(type=")
+		buf.WriteString(reflect.TypeOf(err).String())
+		buf.WriteByte(')')
+		h.appendANSI(buf, cliReset)
+	}
 }
 
-func (h *Handler) appendSource(buf *buffer, src *slog.Source) {
-	dir, file := filepath.Split(src.File)
+// errorText returns the message of err, or "<nil>" when err is a nil pointer
+// whose Error method panics, as slog's own handlers do
+func errorText(err error) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if v := reflect.ValueOf(err); v.Kind() == reflect.Pointer && v.IsNil() {
+				s = "<nil>"
+				return
+			}
+			panic(r)
+		}
+	}()
+	return err.Error()
+}
+
+// callerFrames returns up to n frames of the current call stack starting at
+// the frame of pc. Only the frame of pc is returned if it is not on the stack.
+func callerFrames(pc uintptr, n int) []runtime.Frame {
+	if pc == 0 {
+		return nil
+	}
+	pcs := make([]uintptr, 64)
+	pcs = pcs[:runtime.Callers(1, pcs)]
+	if i := slices.Index(pcs, pc); i >= 0 {
+		pcs = pcs[i:]
+	} else {
+		pcs = []uintptr{pc}
+	}
 
+	var frames []runtime.Frame
+	fs := runtime.CallersFrames(pcs)
+	for len(frames) < n {
+		f, more := fs.Next()
+		if f.File != "" {
+			frames = append(frames, f)
+		}
+		if !more {
+			break
+		}
+	}
+	return frames
+}
+
+func (h *Handler) appendSource(buf *buffer, src *slog.Source) {
 	h.appendANSI(buf, cliFaint)
-	buf.WriteString(filepath.Join(filepath.Base(dir), file))
+	buf.WriteString(h.sourcePath(src.File))
 	buf.WriteByte(':')
 	buf.WriteString(strconv.Itoa(src.Line))
 	h.appendANSI(buf, cliReset)
 }
 
+// sourcePath shortens path to its file name, to be relative to the module root,
+// or to dir/file if the path is not under the root
+func (h *Handler) sourcePath(path string) string {
+	if h.sourceBase {
+		return filepath.Base(path)
+	}
+	if h.sourceRoot != "" {
+		rel, err := filepath.Rel(h.sourceRoot, path)
+		if err == nil && filepath.IsLocal(rel) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	dir, file := filepath.Split(path)
+	return filepath.Join(filepath.Base(dir), file)
+}
+
 func (h *Handler) appendANSI(buf *buffer, color cliColor) {
-	if !h.noColor {
+	if !h.colorOff() {
 		buf.WriteString(string(color))
 	}
 }
 
+// hashColor picks a stable color from hashPalette for s
+func hashColor(s string) cliColor {
+	hash := fnv.New32a()
+	hash.Write([]byte(s))
+	return hashPalette[hash.Sum32()%uint32(len(hashPalette))]
+}
+
+// colorLine wraps line in color. Any reset inside the line, such as the one
+// ending a colored key or value, is followed by color again before the next
+// text so the line color is restored instead of cleared. Escapes that would
+// not change the output, such as color when it is already in effect, are left
+// out.
+func colorLine(line []byte, color cliColor) []byte {
+	out := make([]byte, 0, len(line)+2*len(color)+len(cliReset))
+	var cur string // the color in effect, "" after a reset
+	for i := 0; i < len(line); {
+		n := ansiLen(string(line[i:]))
+		if n == 0 || line[i+n-1] != 'm' {
+			// text or a non-SGR escape is written in the line color
+			if cur == "" {
+				out = append(out, color...)
+				cur = string(color)
+			}
+			n = max(n, 1)
+			out = append(out, line[i:i+n]...)
+			i += n
+			continue
+		}
+		seq := string(line[i : i+n])
+		i += n
+		switch {
+		case seq == string(cliReset):
+			cur = ""
+		case seq == string(color) && cur == seq:
+			continue
+		case isForeground(seq):
+			cur = seq
+		case cur == "":
+			// an attribute such as faint keeps the line color
+			out = append(out, color...)
+			cur = string(color)
+		}
+		out = append(out, seq...)
+	}
+	if cur != "" {
+		out = append(out, cliReset...)
+	}
+	return out
+}
+
+// isForeground reports whether the SGR escape seq sets the foreground color
+func isForeground(seq string) bool {
+	params := strings.TrimSuffix(strings.TrimPrefix(seq, "\033["), "m")
+	if strings.HasPrefix(params, "38;") {
+		return true
+	}
+	n, err := strconv.Atoi(params)
+	return err == nil && (n >= 30 && n <= 37 || n >= 90 && n <= 97)
+}
+
 // appendString formats using the default formats for its operands and writes to buf.
 func appendString(buf *buffer, s string) {
 	buf.WriteString(s)
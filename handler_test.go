@@ -2,16 +2,22 @@ package cli
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"runtime"
 	"strconv"
 
 	"log/slog"
+	"maps"
+	"net/url"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -167,7 +173,7 @@ func TestCLIHandler(t *testing.T) {
 		{
 			name:     "attrs",
 			attrs:    testAttrs,
-			wantText: "2000-01-02 03:04:05  INFO message string=\"7e3b3b2aaeff56a7108fe11e154200dd/7819479873059528190\" status=32768 duration=\"23s\" time=\"2000-01-02 03:04:05.000000006 +0000 UTC\" error=\"fail\"",
+			wantText: "2000-01-02 03:04:05  INFO message string=\"7e3b3b2aaeff56a7108fe11e154200dd/7819479873059528190\" status=32768 duration=\"23s\" time=\"2000-01-02 03:04:05\" error=\"fail\"",
 		},
 		{
 			name:     "preformatted",
@@ -278,7 +284,7 @@ func TestCLIHandler(t *testing.T) {
 		{
 			name:     "GroupValue as Attr value",
 			replace:  removeKeys(slog.TimeKey, slog.LevelKey),
-			attrs:    []slog.Attr{{"v", slog.AnyValue(slog.IntValue(3))}},
+			attrs:    []slog.Attr{{Key: "v", Value: slog.AnyValue(slog.IntValue(3))}},
 			wantText: "message v=3",
 		},
 		{
@@ -457,6 +463,2030 @@ func TestReplaceAttrGroups(t *testing.T) {
 	}
 }
 
+func TestTrackErrorGap(t *testing.T) {
+	var buf bytes.Buffer
+	now := testTime
+	h := NewHandler(&buf, &HandlerOptions{
+		TrackErrorGap: true,
+		NoColor:       true,
+		ReplaceAttr:   removeKeys(slog.TimeKey),
+		Clock:         func() time.Time { return now },
+	})
+	logger := slog.New(h)
+
+	logger.Error("first")
+	logger.Info("between")
+	now = now.Add(90 * time.Second)
+	logger.Error("second")
+
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		`ERROR first since_last_error="never"`,
+		` INFO between`,
+		`ERROR second since_last_error="1m30s"`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestLevelEnvVar(t *testing.T) {
+	ctx := context.Background()
+	opts := &HandlerOptions{Level: slog.LevelWarn, LevelEnvVar: "CLI_TEST_LOG_LEVEL"}
+
+	t.Setenv("CLI_TEST_LOG_LEVEL", "debug")
+	h := NewHandler(io.Discard, opts)
+	if !h.Enabled(ctx, slog.LevelDebug) {
+		t.Error("debug level not enabled from environment")
+	}
+
+	t.Setenv("CLI_TEST_LOG_LEVEL", "chatty")
+	h = NewHandler(io.Discard, opts)
+	if h.Enabled(ctx, slog.LevelInfo) || !h.Enabled(ctx, slog.LevelWarn) {
+		t.Error("invalid environment level did not fall back to opts.Level")
+	}
+}
+
+func TestSourceModuleRoot(t *testing.T) {
+	root := filepath.FromSlash("/src/project")
+	for _, test := range []struct {
+		name string
+		file string
+		want string
+	}{
+		{"inside root", "/src/project/internal/server/handler.go", "internal/server/handler.go:42"},
+		{"root file", "/src/project/main.go", "main.go:42"},
+		{"outside root", "/usr/lib/go/src/net/http/server.go", "http/server.go:42"},
+		{"sibling prefix", "/src/project2/main.go", "project2/main.go:42"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h := NewHandler(io.Discard, &HandlerOptions{SourceModuleRoot: root, NoColor: true}).(*Handler)
+			b := newBuffer()
+			defer b.Free()
+			h.appendSource(b, &slog.Source{File: filepath.FromSlash(test.file), Line: 42})
+			if got := b.String(); got != test.want {
+				t.Errorf("\ngot  %s\nwant %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHashColorKeys(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{HashColorKeys: []string{"user"}})
+	logger := slog.New(h)
+
+	valueColor := func(user string) string {
+		buf.Reset()
+		logger.Info("m", "user", user, "other", user)
+		line := buf.String()
+		start := strings.Index(line, "user=") + len("user=") + len(cliReset)
+		end := strings.Index(line[start:], `"`)
+		return line[start : start+end]
+	}
+
+	alice := valueColor("alice")
+	if alice == "" {
+		t.Fatal("hash color key was not colored")
+	}
+	if got := valueColor("alice"); got != alice {
+		t.Errorf("same value colored differently: %q != %q", got, alice)
+	}
+	if got := valueColor("bob"); got == alice {
+		t.Errorf("different values share color %q", got)
+	}
+	if strings.Contains(buf.String(), `other=`+string(cliReset)+string(hashColor("bob"))) {
+		t.Error("key not in HashColorKeys was colored")
+	}
+
+	buf.Reset()
+	h = NewHandler(&buf, &HandlerOptions{HashColorKeys: []string{"user"}, NoColor: true})
+	slog.New(h).Info("m", "user", "alice")
+	if strings.Contains(buf.String(), "\033[") {
+		t.Errorf("NoColor output contains color codes: %q", buf.String())
+	}
+}
+
+func TestLineTransform(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr:   removeKeys(slog.TimeKey),
+		NoColor:       true,
+		LineTransform: bytes.ToUpper,
+	})
+	slog.New(h).Info("hello", "name", "world")
+
+	got := buf.String()
+	want := " INFO HELLO NAME=\"WORLD\"\n"
+	if got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestSetTimeFormat(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{NoColor: true}).(*Handler)
+	child := h.WithAttrs([]slog.Attr{slog.Int("a", 1)})
+
+	log := func(h slog.Handler) {
+		r := slog.NewRecord(testTime, slog.LevelInfo, "m", 0)
+		if err := h.Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log(h)
+	h.SetTimeFormat(time.RFC3339)
+	log(h)
+	log(child)
+	log(h.WithGroup("g"))
+
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"2000-01-02 03:04:05  INFO m",
+		"2000-01-02T03:04:05Z  INFO m",
+		"2000-01-02 03:04:05  INFO m a=1",
+		"2000-01-02T03:04:05Z  INFO m",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestSuppressEmpty(t *testing.T) {
+	removeAll := func(_ []string, a slog.Attr) slog.Attr { return slog.Attr{} }
+	for _, test := range []struct {
+		name     string
+		suppress bool
+		want     string
+	}{
+		{"default", false, "\n"},
+		{"suppress", true, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := NewHandler(&buf, &HandlerOptions{
+				ReplaceAttr:   removeAll,
+				SuppressEmpty: test.suppress,
+				NoColor:       true,
+			})
+			slog.New(h).Info("message", "a", 1)
+			if got := buf.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFoldCommonPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		FoldCommonPrefix: true,
+		ReplaceAttr:      removeKeys(slog.TimeKey),
+		NoColor:          true,
+	})
+	slog.New(h).Info("request",
+		slog.String("id", "abc"),
+		slog.Group("http",
+			slog.String("method", "GET"),
+			slog.String("path", "/"),
+			slog.Group("response", slog.Int("status", 200))),
+		slog.Group("db", slog.Int("queries", 3)),
+	)
+
+	got := buf.String()
+	want := ` INFO request id="abc" db.queries=3
+  http:
+    method="GET"
+    path="/"
+    response.status=200
+`
+	if got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestLevelWidth(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		width int
+		want  []string
+	}{
+		{"auto", 0, []string{"DEBUG d", " INFO i", " WARN w", "ERROR e"}},
+		{"wider", 7, []string{"  DEBUG d", "   INFO i", "   WARN w", "  ERROR e"}},
+		{"narrower", 3, []string{"DEB d", "INF i", "WAR w", "ERR e"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := NewHandler(&buf, &HandlerOptions{
+				Level:       slog.LevelDebug,
+				LevelWidth:  test.width,
+				ReplaceAttr: removeKeys(slog.TimeKey),
+				NoColor:     true,
+			})
+			logger := slog.New(h)
+			logger.Debug("d")
+			logger.Info("i")
+			logger.Warn("w")
+			logger.Error("e")
+
+			got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+			if !slices.Equal(got, test.want) {
+				t.Errorf("\ngot  %q\nwant %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	t.Setenv("TERM", "xterm")
+	fakeTerminal(t, true)
+	if h := NewHandler(io.Discard, nil).(*Handler); !h.ColorEnabled() {
+		t.Error("color disabled by default")
+	}
+	if h := NewHandler(io.Discard, &HandlerOptions{NoColor: true}).(*Handler); h.ColorEnabled() {
+		t.Error("color enabled with NoColor")
+	}
+
+	t.Setenv("TERM", "dumb")
+	if h := NewHandler(io.Discard, nil).(*Handler); h.ColorEnabled() {
+		t.Error("color enabled with TERM=dumb")
+	}
+}
+
+func TestThousandsSeparator(t *testing.T) {
+	attrs := []any{
+		slog.Int("int", 1234567),
+		slog.Int("neg", -32768),
+		slog.Int("small", 999),
+		slog.Uint64("uint", 1000),
+		slog.Float64("float", 12345.678),
+		slog.Float64("sci", 1.5e21),
+	}
+	for _, test := range []struct {
+		name string
+		opts HandlerOptions
+		want string
+	}{
+		{
+			name: "off",
+			want: " INFO m int=1234567 neg=-32768 small=999 uint=1000 float=12345.678 sci=1.5e+21",
+		},
+		{
+			name: "comma",
+			opts: HandlerOptions{ThousandsSeparator: true},
+			want: " INFO m int=1,234,567 neg=-32,768 small=999 uint=1,000 float=12,345.678 sci=1.5e+21",
+		},
+		{
+			name: "custom rune",
+			opts: HandlerOptions{ThousandsSeparator: true, ThousandsSeparatorRune: '_'},
+			want: " INFO m int=1_234_567 neg=-32_768 small=999 uint=1_000 float=12_345.678 sci=1.5e+21",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := test.opts
+			opts.ReplaceAttr = removeKeys(slog.TimeKey)
+			opts.NoColor = true
+			slog.New(NewHandler(&buf, &opts)).Info("m", attrs...)
+			if got := strings.TrimRight(buf.String(), "\n"); got != test.want {
+				t.Errorf("\ngot  %s\nwant %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShowAttrCount(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ShowAttrCount: true,
+		ReplaceAttr:   removeKeys(slog.TimeKey, "secret", "token"),
+		NoColor:       true,
+	})
+	logger := slog.New(h).With("app", "cli", "token", "abc")
+
+	logger.Info("login", "user", "ren", "secret", "hunter2", slog.Group("g", "a", 1, "b", 2))
+	logger.Info("ping")
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		` INFO login app="cli" user="ren" g.a=1 g.b=2 (4 fields)`,
+		` INFO ping app="cli" (1 field)`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestShortKeys(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		attrs []any
+		want  string
+	}{
+		{
+			name:  "unique",
+			attrs: []any{slog.Group("http", "method", "GET", "status", 200)},
+			want:  ` INFO m method="GET" status=200`,
+		},
+		{
+			name:  "collision",
+			attrs: []any{"status", "ok", slog.Group("http", "method", "GET", "status", 200)},
+			want:  ` INFO m status="ok" method="GET" http.status=200`,
+		},
+		{
+			name:  "nested",
+			attrs: []any{slog.Group("http", slog.Group("req", "method", "GET"))},
+			want:  ` INFO m http.req.method="GET"`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := NewHandler(&buf, &HandlerOptions{
+				ShortKeys:   true,
+				ReplaceAttr: removeKeys(slog.TimeKey),
+				NoColor:     true,
+			})
+			slog.New(h).Info("m", test.attrs...)
+			if got := strings.TrimRight(buf.String(), "\n"); got != test.want {
+				t.Errorf("\ngot  %s\nwant %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEmptyKeyHandling(t *testing.T) {
+	attrs := []any{slog.String("a", "one"), slog.Any("", "v")}
+	for _, test := range []struct {
+		name string
+		mode EmptyKeyMode
+		key  string
+		want string
+	}{
+		{"quote", EmptyKeyQuote, "", ` INFO message a="one" ""="v"`},
+		{"drop", EmptyKeyDrop, "", ` INFO message a="one"`},
+		{"placeholder", EmptyKeyPlaceholder, "", ` INFO message a="one" _="v"`},
+		{"named placeholder", EmptyKeyPlaceholder, "value", ` INFO message a="one" value="v"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := NewHandler(&buf, &HandlerOptions{
+				EmptyKeyHandling: test.mode,
+				EmptyKeyName:     test.key,
+				ReplaceAttr:      removeKeys(slog.TimeKey),
+				NoColor:          true,
+			})
+			slog.New(h).Info("message", attrs...)
+			if got := strings.TrimRight(buf.String(), "\n"); got != test.want {
+				t.Errorf("\ngot  %s\nwant %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSourceBasenameOnly(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		AddSource:          true,
+		SourceBasenameOnly: true,
+		ReplaceAttr:        removeKeys(slog.TimeKey),
+		NoColor:            true,
+	})
+	r := slog.NewRecord(time.Time{}, slog.LevelInfo, "message", callerPC(2))
+	_, _, line, _ := runtime.Caller(0)
+	if err := h.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.TrimRight(buf.String(), "\n")
+	want := " INFO handler_test.go:" + strconv.Itoa(line-1) + " message"
+	if got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestDebugState(t *testing.T) {
+	h := NewHandler(io.Discard, nil).
+		WithAttrs([]slog.Attr{slog.String("app", "cli")}).
+		WithGroup("a").
+		WithAttrs([]slog.Attr{slog.Int("x", 1), slog.String("y", "two")}).
+		WithGroup("b")
+
+	got := h.(*Handler).DebugState()
+	want := `groups: ["a" "b"]
+group prefix: "a.b."
+attrs (3): app="cli" a.x=1 a.y="two"
+`
+	if got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestWithAttrsOutput(t *testing.T) {
+	// WithAttrs attributes are stored structurally and rendered with each
+	// record, the output must match what was rendered when they were
+	// preformatted into a prefix
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{ForceColor: true, ReplaceAttr: removeKeys(slog.TimeKey)})
+	logger := slog.New(h).
+		With("app", "cli", slog.Group("g", "a", 1)).
+		WithGroup("s").
+		With("err", errors.New("boom"), "", "v")
+	logger.Warn("m", "b", 2)
+
+	got := buf.String()
+	want := "\x1b[33m WARN\x1b[0m m \x1b[2mapp=\x1b[0m\"cli\" \x1b[2mg.a=\x1b[0m1 " +
+		"\x1b[2m\x1b[31ms.err=\x1b[0m\"boom\" \x1b[2m\"\"=\x1b[0m\"v\" \x1b[2ms.b=\x1b[0m2\n"
+	if got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestDurationColorThresholds(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor: true,
+		DurationColorThresholds: []DurationThreshold{
+			{At: 5 * time.Second, Color: string(cliFgRed)},
+			{At: time.Second, Color: string(cliFgYellow)},
+		},
+		ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+	})
+	slog.New(h).Info("", "fast", 500*time.Millisecond, "slow", 2*time.Second, "slower", 5*time.Second)
+
+	key := func(k string) string { return string(cliFaint) + k + "=" + string(cliReset) }
+	got := strings.TrimRight(buf.String(), "\n")
+	want := key("fast") + `"500ms" ` +
+		key("slow") + string(cliFgYellow) + `"2s"` + string(cliReset) + " " +
+		key("slower") + string(cliFgRed) + `"5s"` + string(cliReset)
+	if got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestReconfigureDefault(t *testing.T) {
+	orig := slog.Default()
+	defer slog.SetDefault(orig)
+
+	opts := &HandlerOptions{ReplaceAttr: removeKeys(slog.TimeKey), NoColor: true}
+	var first, second bytes.Buffer
+	SetAsDefault(&first, opts)
+	slog.Info("before")
+
+	// keep logging from other goroutines while swapping
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					slog.Info("busy")
+				}
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond)
+	ReconfigureDefault(&second, opts)
+	time.Sleep(time.Millisecond)
+	close(stop)
+	wg.Wait()
+	slog.Info("after")
+
+	// every record is written whole to one of the writers
+	firstLines := strings.Split(strings.TrimRight(first.String(), "\n"), "\n")
+	if firstLines[0] != " INFO before" {
+		t.Errorf("first writer starts with %q", firstLines[0])
+	}
+	for _, line := range firstLines[1:] {
+		if line != " INFO busy" {
+			t.Fatalf("first writer got %q", line)
+		}
+	}
+	secondLines := strings.Split(strings.TrimRight(second.String(), "\n"), "\n")
+	if last := secondLines[len(secondLines)-1]; last != " INFO after" {
+		t.Errorf("second writer ends with %q", last)
+	}
+	for _, line := range secondLines[:len(secondLines)-1] {
+		if line != " INFO busy" {
+			t.Fatalf("second writer got %q", line)
+		}
+	}
+}
+
+type traceKey struct{}
+
+func TestTraceContext(t *testing.T) {
+	extract := func(ctx context.Context) (string, string, bool) {
+		ids, ok := ctx.Value(traceKey{}).([2]string)
+		return ids[0], ids[1], ok
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		TraceContext: extract,
+		ReplaceAttr:  removeKeys(slog.TimeKey),
+		NoColor:      true,
+	}))
+
+	ctx := context.WithValue(context.Background(), traceKey{}, [2]string{"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"})
+	logger.InfoContext(ctx, "traced", "a", 1)
+	logger.InfoContext(context.Background(), "untraced", "a", 1)
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		` INFO traced a=1 trace_id="4bf92f3577b34da6a3ce929d0e0e4736" span_id="00f067aa0ba902b7"`,
+		` INFO untraced a=1`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestSyslogLevelNames(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		Level:            slog.LevelDebug,
+		SyslogLevelNames: true,
+		ReplaceAttr:      removeKeys(slog.TimeKey),
+		NoColor:          true,
+	})
+	ctx := context.Background()
+	logger := slog.New(h)
+	for _, level := range []slog.Level{
+		slog.LevelDebug, slog.LevelInfo, slog.LevelInfo + 2,
+		slog.LevelWarn, slog.LevelError, slog.LevelError + 4,
+	} {
+		logger.Log(ctx, level, "m")
+	}
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		"  DEBUG m",
+		"   INFO m",
+		" NOTICE m",
+		"WARNING m",
+		"    ERR m",
+		"   CRIT m",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestColorWholeLine(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor:     true,
+		ColorWholeLine: true,
+		HashColorKeys:  []string{"user"},
+		ReplaceAttr:    removeKeys(slog.TimeKey),
+	})
+	logger := slog.New(h)
+	logger.Warn("m", "user", "ren", "a", 1)
+	logger.Info("m", "a", 1)
+
+	yellow, faint, reset := string(cliFgYellow), string(cliFaint), string(cliReset)
+	userColor := string(hashColor("ren"))
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		yellow + " WARN" + reset + yellow + " m " +
+			faint + "user=" + reset + userColor + `"ren"` + reset + yellow + " " +
+			faint + "a=" + reset + yellow + "1" + reset,
+		" INFO m " + faint + "a=" + reset + "1",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestColorLine(t *testing.T) {
+	red, bold, reset := string(cliFgRed), string(cliBold), string(cliReset)
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"a", red + "a" + reset},
+		{red + "a" + reset + "b", red + "a" + reset + red + "b" + reset},
+		{bold + "a" + reset + "b", red + bold + "a" + reset + red + "b" + reset},
+		{"\033[38;5;208ma" + reset, "\033[38;5;208ma" + reset},
+	} {
+		if got := string(colorLine([]byte(test.in), cliFgRed)); got != test.want {
+			t.Errorf("colorLine(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestColorWholeLineSuppressEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor:     true,
+		ColorWholeLine: true,
+		SuppressEmpty:  true,
+		ReplaceAttr:    removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey, "drop"),
+	})
+	slog.New(h).Warn("m", "drop", 1)
+
+	if got := buf.String(); got != "" {
+		t.Errorf("empty line was written: %q", got)
+	}
+}
+
+func TestOnRecord(t *testing.T) {
+	counts := make(map[slog.Level]int)
+	h := NewHandler(io.Discard, &HandlerOptions{
+		Level:         slog.LevelInfo,
+		SuppressEmpty: true,
+		ReplaceAttr:   removeKeys(slog.TimeKey, slog.LevelKey, "drop"),
+		OnRecord:      func(level slog.Level) { counts[level]++ },
+	})
+	logger := slog.New(h).With("a", 1)
+	logger.Debug("below level")
+	logger.Info("one")
+	logger.Info("two")
+	logger.Warn("three")
+	logger.Error("four")
+	slog.New(h).Error("", "drop", true) // formats to an empty line
+
+	want := map[slog.Level]int{slog.LevelInfo: 2, slog.LevelWarn: 1, slog.LevelError: 1}
+	if !maps.Equal(counts, want) {
+		t.Errorf("got %v, want %v", counts, want)
+	}
+}
+
+func TestColumnar(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		Columnar:    true,
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	})
+	logger := slog.New(h)
+	logger.Info("request", "path", "/", "status", 200, "bytes", 5)
+	logger.Warn("slow request served", "path", "/find", "status", 200, "bytes", 123456)
+	logger.Error("failed", "path", "/a/b/c", "status", 500, "bytes", 0)
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		` INFO request                  path="/"      status=     200 bytes=       5`,
+		` WARN slow request served      path="/find"  status=     200 bytes=  123456`,
+		`ERROR failed                   path="/a/b/c" status=     500 bytes=       0`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStripMessageANSI(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor:       true,
+		StripMessageANSI: true,
+		ReplaceAttr:      removeKeys(slog.TimeKey),
+	})
+	slog.New(h).Warn("\033[1;32mbuild\033[0m passed", "a", 1)
+
+	yellow, faint, reset := string(cliFgYellow), string(cliFaint), string(cliReset)
+	want := yellow + " WARN" + reset + " build passed " + faint + "a=" + reset + "1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestGroupPathColumn(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		GroupPathColumn: true,
+		ReplaceAttr:     removeKeys(slog.TimeKey),
+		NoColor:         true,
+	})
+	logger := slog.New(h)
+	logger.With("app", "web").WithGroup("http").WithGroup("request").
+		With("method", "GET").Info("served", "status", 200, slog.Group("user", "id", 7))
+	logger.Info("no groups", "a", 1)
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		` INFO [http.request] served app="web" method="GET" status=200 user.id=7`,
+		` INFO no groups a=1`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+type lineColorKey struct{}
+
+func TestLineColorFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor:  true,
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		LineColorFromContext: func(ctx context.Context) (string, bool) {
+			color, ok := ctx.Value(lineColorKey{}).(string)
+			return color, ok
+		},
+	})
+	logger := slog.New(h)
+	ctx := context.WithValue(context.Background(), lineColorKey{}, string(cliFgMagenta))
+	logger.InfoContext(ctx, "m", "a", 1)
+	logger.InfoContext(context.Background(), "m", "a", 1)
+
+	magenta, faint, reset := string(cliFgMagenta), string(cliFaint), string(cliReset)
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		magenta + " INFO m " + faint + "a=" + reset + magenta + "1" + reset,
+		" INFO m " + faint + "a=" + reset + "1",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestAttrStyleQuery(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor:  true,
+		AttrStyle:   AttrStyleQuery,
+		ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey),
+	})
+	logger := slog.New(h)
+	logger.Info("m", "a", 1, "b", "two words", "q", "x=1&y=ü/?", slog.Group("g", "ok", true))
+	logger.Info("m", "err", errors.New("not found"), "d", time.Second)
+	logger.Info("none")
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		`m ?a=1&b=two+words&q=x%3D1%26y%3D%C3%BC%2F%3F&g.ok=true`,
+		`m ?err=not+found&d=1s`,
+		`none`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestEmptyMessage(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts HandlerOptions
+		want string
+	}{
+		{"fast path", HandlerOptions{NoColor: true}, " INFO a=1 b=\"x\"\n"},
+		{"replace attr", HandlerOptions{NoColor: true, ReplaceAttr: upperCaseKey}, " INFO A=1 B=\"x\"\n"},
+		{"message width", HandlerOptions{NoColor: true, MessageWidth: 3}, " INFO     a=1 b=\"x\"\n"},
+	} {
+		var buf bytes.Buffer
+		r := slog.NewRecord(time.Time{}, slog.LevelInfo, "", 0)
+		r.AddAttrs(slog.Int("a", 1), slog.String("b", "x"))
+		if err := NewHandler(&buf, &test.opts).Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+type codeError struct{ code int }
+
+func (e codeError) Error() string { return "code " + strconv.Itoa(e.code) }
+
+type ptrError struct{ msg string }
+
+func (e *ptrError) Error() string { return e.msg }
+
+func TestErrorWithType(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ErrorWithType: true,
+		ReplaceAttr:   removeKeys(slog.TimeKey),
+		NoColor:       true,
+	})
+	logger := slog.New(h)
+	base := errors.New("fail")
+	logger.Error("m", "err", base)
+	logger.Error("m", "err", fmt.Errorf("wrapped: %w", base))
+	logger.Error("m", "err", codeError{404}, "a", 1)
+	var nilErr *ptrError
+	logger.Error("m", "err", nilErr)
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		`ERROR m err="fail" (type=*errors.errorString)`,
+		`ERROR m err="wrapped: fail" (type=*fmt.wrapError)`,
+		`ERROR m err="code 404" (type=cli.codeError) a=1`,
+		`ERROR m err="<nil>" (type=*cli.ptrError)`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestRenamedBuiltins(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		MessageWidth: 6,
+		NoColor:      true,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch a.Key {
+			case slog.TimeKey:
+				return slog.Int64("ts", a.Value.Time().Unix())
+			case slog.LevelKey:
+				return slog.String("severity", "warning")
+			case slog.MessageKey:
+				a.Key = "message"
+			}
+			return a
+		},
+	})
+	r := slog.NewRecord(testTime, slog.LevelWarn, "m", 0)
+	r.AddAttrs(slog.Int("a", 1))
+	if err := h.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := buf.String(), "946782245 warning m      a=1\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestValidateUTF8(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ValidateUTF8: true,
+		ReplaceAttr:  removeKeys(slog.TimeKey),
+		NoColor:      true,
+	})
+	logger := slog.New(h)
+	logger.Info("m", "s", "ok\xff\xfeend", "b", []byte("bin\xc3"), "k\x80ey", 1)
+
+	want := " INFO m s=\"ok�end\" b=bin� k�ey=1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAddRuntimeStats(t *testing.T) {
+	samples := 0
+	orig := readRuntimeStats
+	readRuntimeStats = func() (float64, int) {
+		samples++
+		return 1.5, samples
+	}
+	t.Cleanup(func() { readRuntimeStats = orig })
+
+	now := testTime
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		AddRuntimeStats:      true,
+		RuntimeStatsInterval: time.Minute,
+		ReplaceAttr:          removeKeys(slog.TimeKey),
+		NoColor:              true,
+		Clock:                func() time.Time { return now },
+	})
+	logger := slog.New(h)
+	logger.Info("first", "a", 1)
+	now = now.Add(time.Minute - time.Nanosecond)
+	logger.Info("cached")
+	now = now.Add(time.Nanosecond)
+	logger.Info("resampled")
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		` INFO first a=1 heap=1.5 goroutines=1`,
+		` INFO cached heap=1.5 goroutines=1`,
+		` INFO resampled heap=1.5 goroutines=2`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestReadRuntimeStats(t *testing.T) {
+	if heap, goroutines := readRuntimeStats(); heap <= 0 || goroutines < 1 {
+		t.Errorf("readRuntimeStats() = %v, %v", heap, goroutines)
+	}
+}
+
+func TestKeyEscape(t *testing.T) {
+	for _, test := range []struct {
+		mode KeyEscapeMode
+		want string
+	}{
+		{KeyEscapeQuote, `"a=b"=1 "x y"="v" "g.e=rr"="fail"`},
+		{KeyEscapeStrip, `ab=1 xy="v" g.err="fail"`},
+		{KeyEscapeReplace, `a_b=1 x_y="v" g.e_rr="fail"`},
+	} {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, &HandlerOptions{
+			KeyEscape:   test.mode,
+			ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+			NoColor:     true,
+		})
+		slog.New(h).Info("", "a=b", 1, "x y", "v", slog.Group("g", "e=rr", errors.New("fail")))
+		if got := strings.TrimRight(buf.String(), "\n"); got != test.want {
+			t.Errorf("mode %d\ngot  %s\nwant %s", test.mode, got, test.want)
+		}
+	}
+}
+
+func TestWithAuditSink(t *testing.T) {
+	var buf, audit bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		Level:       slog.LevelWarn,
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}).(*Handler)
+	logger := slog.New(h.WithAuditSink(&audit, slog.LevelInfo)).With("user", "ren")
+	logger.Debug("ignored")
+	logger.Info("login", "ip", "10.0.0.1")
+	logger.Warn("password changed")
+
+	if got, want := buf.String(), " WARN password changed user=\"ren\"\n"; got != want {
+		t.Errorf("main output\ngot  %q\nwant %q", got, want)
+	}
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimRight(audit.String(), "\n"), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("audit line %q: %v", line, err)
+		}
+		delete(m, "time")
+		records = append(records, m)
+	}
+	want := []map[string]any{
+		{"level": "INFO", "msg": "login", "user": "ren", "ip": "10.0.0.1"},
+		{"level": "WARN", "msg": "password changed", "user": "ren"},
+	}
+	if !slices.EqualFunc(records, want, maps.Equal[map[string]any]) {
+		t.Errorf("audit output\ngot  %v\nwant %v", records, want)
+	}
+}
+
+func TestWithAuditSinkOrder(t *testing.T) {
+	redact := func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == "token" {
+			return slog.String("token", "***")
+		}
+		return removeKeys(slog.TimeKey)(groups, a)
+	}
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{ReplaceAttr: redact, NoColor: true}).(*Handler)
+
+	// the same attrs and group, added before and after the sink is attached
+	var before, after bytes.Buffer
+	base := h.WithAttrs([]slog.Attr{slog.String("token", "secret")}).WithGroup("req").(*Handler)
+	slog.New(base.WithAuditSink(&before, slog.LevelInfo)).Info("m", "id", 1)
+	audited := h.WithAuditSink(&after, slog.LevelInfo)
+	slog.New(audited.WithAttrs([]slog.Attr{slog.String("token", "secret")}).WithGroup("req")).Info("m", "id", 1)
+
+	want := `{"level":"INFO","msg":"m","token":"secret","req":{"id":1}}`
+	for name, out := range map[string]*bytes.Buffer{"before": &before, "after": &after} {
+		got := regexp.MustCompile(`"time":"[^"]*",`).ReplaceAllString(strings.TrimSpace(out.String()), "")
+		if got != want {
+			t.Errorf("attrs added %s the sink\ngot  %s\nwant %s", name, got, want)
+		}
+	}
+	if got, want := buf.String(), " INFO m token=\"***\" req.id=1\n INFO m token=\"***\" req.id=1\n"; got != want {
+		t.Errorf("main output\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestTimeFormatEpoch(t *testing.T) {
+	tm := time.Date(2000, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	for _, test := range []struct {
+		format string
+		want   string
+	}{
+		{TimeFormatUnix, "946782245  INFO m at=946782245"},
+		{TimeFormatUnixMilli, "946782245123  INFO m at=946782245123"},
+		{TimeFormatUnixNano, "946782245123456789  INFO m at=946782245123456789"},
+	} {
+		for _, opts := range []HandlerOptions{
+			{TimeFormat: test.format, NoColor: true},
+			{TimeFormat: test.format, NoColor: true, ReplaceAttr: removeKeys("none")},
+		} {
+			var buf bytes.Buffer
+			r := slog.NewRecord(tm, slog.LevelInfo, "m", 0)
+			r.AddAttrs(slog.Time("at", tm))
+			if err := NewHandler(&buf, &opts).Handle(context.Background(), r); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimRight(buf.String(), "\n"); got != test.want {
+				t.Errorf("%s: got %q, want %q", test.format, got, test.want)
+			}
+		}
+	}
+}
+
+func TestGroupColors(t *testing.T) {
+	for _, noColor := range []bool{false, true} {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, &HandlerOptions{
+			ForceColor:  true,
+			GroupColors: map[string]string{"http": string(cliFgCyan), "db": string(cliFgMagenta)},
+			ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+			NoColor:     noColor,
+		})
+		slog.New(h).Info("", "a", 1,
+			slog.Group("http", "method", "GET", slog.Group("req", "id", 7)),
+			slog.Group("db", "rows", 3))
+
+		cyan, magenta, faint, reset := string(cliFgCyan), string(cliFgMagenta), string(cliFaint), string(cliReset)
+		want := faint + "a=" + reset + "1 " +
+			cyan + "http.method=" + reset + cyan + `"GET"` + reset + " " +
+			cyan + "http.req.id=" + reset + cyan + "7" + reset + " " +
+			magenta + "db.rows=" + reset + magenta + "3" + reset
+		if noColor {
+			want = `a=1 http.method="GET" http.req.id=7 db.rows=3`
+		}
+		if got := strings.TrimRight(buf.String(), "\n"); got != want {
+			t.Errorf("noColor=%v\ngot  %q\nwant %q", noColor, got, want)
+		}
+	}
+}
+
+func TestCollapseWhitespace(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		CollapseWhitespace: true,
+		ReplaceAttr:        removeKeys(slog.TimeKey),
+		NoColor:            true,
+	})
+	slog.New(h).Info("m", "out", "NAME\t\tSTATUS  \n  web \t running\n", "a b", "x")
+
+	want := " INFO m out=\"NAME STATUS web running \" \"a b\"=\"x\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDurationBudgetKeys(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor:         true,
+		DurationBudgetKeys: map[string]time.Duration{"took": 5 * time.Second},
+		ReplaceAttr:        removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+	})
+	logger := slog.New(h)
+	logger.Info("", "took", 1200*time.Millisecond)
+	logger.Info("", "took", 6*time.Second)
+	logger.Info("", "wait", 6*time.Second)
+	logger.Info("", "took", -50*time.Millisecond)
+
+	red, faint, reset := string(cliFgRed), string(cliFaint), string(cliReset)
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		faint + "took=" + reset + `"1.2s"(24%)`,
+		faint + "took=" + reset + `"6s"` + red + "(120%)" + reset,
+		faint + "wait=" + reset + `"6s"`,
+		faint + "took=" + reset + `"-50ms"(-1%)`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestCustomLevelColors(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor: true,
+		Level:      slog.LevelDebug,
+		CustomLevelColors: []LevelStyle{
+			{Min: slog.LevelInfo + 2, Max: slog.LevelInfo + 2, Label: "NOTICE", Color: string(cliFgCyan)},
+			{Min: slog.LevelError + 1, Max: slog.LevelError + 8, Color: string(cliFgMagenta)},
+		},
+		ReplaceAttr: removeKeys(slog.TimeKey),
+	})
+	logger := slog.New(h)
+	ctx := context.Background()
+	logger.Log(ctx, slog.LevelInfo+2, "m")
+	logger.Log(ctx, slog.LevelInfo+1, "m")
+	logger.Log(ctx, slog.LevelError+4, "m")
+	logger.Info("m")
+
+	cyan, magenta, reset := string(cliFgCyan), string(cliFgMagenta), string(cliReset)
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		cyan + "NOTICE" + reset + " m",
+		"INFO+1 m",
+		magenta + "ERROR+4" + reset + " m",
+		"  INFO m",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestCustomLevelBandColor(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor: true,
+		Level:      slog.LevelDebug,
+		CustomLevelColors: []LevelStyle{
+			{Min: slog.LevelError + 4, Max: slog.LevelError + 4, Label: "CRITICAL"},
+		},
+		ReplaceAttr: removeKeys(slog.TimeKey),
+	})
+	logger := slog.New(h)
+	ctx := context.Background()
+	logger.Log(ctx, slog.LevelError+4, "m")
+	logger.Log(ctx, slog.LevelWarn+1, "m")
+	logger.Log(ctx, slog.LevelDebug+2, "m")
+	logger.Log(ctx, slog.LevelInfo+2, "m")
+
+	red, yellow, blue, reset := string(cliFgRed), string(cliFgYellow), string(cliFgBlue), string(cliReset)
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		red + "CRITICAL" + reset + " m",
+		yellow + "  WARN+1" + reset + " m",
+		blue + " DEBUG+2" + reset + " m",
+		"  INFO+2 m",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestNameStandardOnly(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		Level:            slog.LevelDebug - 4,
+		NameStandardOnly: true,
+		ReplaceAttr:      removeKeys(slog.TimeKey),
+	})
+	logger := slog.New(h)
+	ctx := context.Background()
+	logger.Info("m")
+	logger.Log(ctx, slog.LevelInfo+2, "m")
+	logger.Log(ctx, slog.LevelError+4, "m")
+	logger.Log(ctx, slog.LevelDebug-4, "m")
+	logger.Warn("m")
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		" INFO m",
+		"    2 m",
+		"   12 m",
+		"   -8 m",
+		" WARN m",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestCustomLevelBandColorOverride(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor:     true,
+		ColorWholeLine: true,
+		LevelColors:    map[slog.Level]string{slog.LevelError: string(cliFgMagenta)},
+		ReplaceAttr:    removeKeys(slog.TimeKey),
+	})
+	slog.New(h).Log(context.Background(), slog.LevelError+4, "m")
+
+	magenta, reset := string(cliFgMagenta), string(cliReset)
+	want := magenta + "ERROR+4" + reset + magenta + " m" + reset + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func maskEmail(s string) string {
+	user, domain, ok := strings.Cut(s, "@")
+	if !ok {
+		return "***"
+	}
+	name, tld, _ := strings.Cut(domain, ".")
+	return user[:1] + "***@" + name[:1] + "***." + tld
+}
+
+func maskCard(s string) string {
+	digits := strings.ReplaceAll(s, " ", "")
+	return strings.Repeat("*", len(digits)-4) + digits[len(digits)-4:]
+}
+
+func TestMaskFunc(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		MaskFunc: map[string]func(string) string{
+			"email":     maskEmail,
+			"pay.card":  maskCard,
+			"not_found": maskCard,
+		},
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	})
+	logger := slog.New(h).With("email", "jane@example.com")
+	logger.Info("paid", slog.Group("pay", "card", "4111 1111 1111 1234", "amount", 20), "card", "5500 0000 0000 0004")
+
+	want := ` INFO paid email="j***@e***.com" pay.card="************1234" pay.amount=20 card="5500 0000 0000 0004"` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestWithAttrsColorChange(t *testing.T) {
+	t.Cleanup(func() { SetGlobalNoColor(false) })
+
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{ForceColor: true, ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey)})
+
+	// attrs added while color is on are rendered with the color state in
+	// effect when the record is written
+	derived := h.WithAttrs([]slog.Attr{slog.String("app", "web"), slog.Any("err", errors.New("fail"))})
+	SetGlobalNoColor(true)
+	slog.New(derived).Info("m", "a", 1)
+
+	if got, want := buf.String(), "m app=\"web\" err=\"fail\" a=1\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMaxAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		MaxAttrs:    3,
+		ReplaceAttr: removeKeys(slog.TimeKey, "drop"),
+		NoColor:     true,
+	})
+	logger := slog.New(h).With("a", 1)
+	logger.Info("m", "drop", 0, "b", 2, "c", 3, "d", 4, "e", 5)
+	logger.Info("m", "drop", 0, "b", 2, "c", 3)
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		` INFO m a=1 b=2 c=3 …(+2 more)`,
+		` INFO m a=1 b=2 c=3`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestMaxAttrsSequence(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		MaxAttrs:    2,
+		AddSequence: true,
+		ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey),
+		NoColor:     true,
+	}))
+	logger.Info("m", "a", 1, "b", 2, "c", 3)
+	logger.Info("m", "a", 1)
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		`m a=1 b=2 seq=1 …(+1 more)`,
+		`m a=1 seq=2`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestBytesHexDump(t *testing.T) {
+	long := make([]byte, 300)
+	for i := range long {
+		long[i] = byte(i)
+	}
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		BytesFormat:   BytesHexDump,
+		HexDumpMaxLen: 8,
+		ReplaceAttr:   removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+		NoColor:       true,
+	})
+	logger := slog.New(h)
+	logger.Info("", "short", []byte{0x00, 0x01, 0xab, 0xff}, "empty", []byte{})
+	logger.Info("", "long", long)
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		`short="00 01 ab ff" empty=""`,
+		`long="00 01 02 03 … 28 29 2a 2b (len=300)"`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestCloseGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	h := NewHandler(zw, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}).(*Handler)
+	logger := slog.New(h.WithAttrs([]slog.Attr{slog.Int("a", 1)}))
+	logger.Info("one")
+	logger.Warn("two")
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading compressed log: %v", err)
+	}
+	if got, want := string(data), " INFO one a=1\n WARN two a=1\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCloseConcurrentHandle(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	h := NewHandler(zw, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}).(*Handler)
+	logger := slog.New(h.WithAttrs([]slog.Attr{slog.Int("a", 1)}))
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				logger.Info("m")
+			}
+		}()
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr.Multistream(false)
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading compressed log: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if line != "" && line != " INFO m a=1" {
+			t.Fatalf("corrupt line %q", line)
+		}
+	}
+}
+
+func TestValueFormats(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ValueFormats: map[string]string{
+			"flags":     "%x",
+			"ratio":     "%.2f",
+			"http.addr": "%q",
+			"pt":        "%+v",
+			"unmatched": "%d",
+		},
+		ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+		NoColor:     true,
+	})
+	slog.New(h).Info("", "flags", 255, "ratio", 3.14159, "id", 255,
+		slog.Group("http", "addr", "a b"), "pt", struct{ X, Y int }{1, 2})
+
+	want := `flags=ff ratio=3.14 id=255 http.addr="\"a b\"" pt="{X:1 Y:2}"`
+	if got := strings.TrimRight(buf.String(), "\n"); got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestAddSequence(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		AddSequence: true,
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	})
+	logger := slog.New(h)
+	child := logger.With("a", 1)
+	logger.Info("one")
+	child.Info("two")
+	logger.WithGroup("g").Info("three")
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		` INFO one seq=1`,
+		` INFO two a=1 seq=2`,
+		` INFO three seq=3`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestAddSequenceConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		AddSequence: true,
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+	var wg sync.WaitGroup
+	for g := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := logger.With("g", g)
+			for range 200 {
+				l.Info("m")
+			}
+		}()
+	}
+	wg.Wait()
+
+	seq := regexp.MustCompile(` seq=(\d+)$`)
+	for i, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		m := seq.FindStringSubmatch(line)
+		if m == nil || m[1] != strconv.Itoa(i+1) {
+			t.Fatalf("line %d out of sequence: %q", i+1, line)
+		}
+	}
+}
+
+// logFromHelper logs through logger and returns the line of the log call
+//
+//go:noinline
+func logFromHelper(logger *slog.Logger) int {
+	_, _, line, _ := runtime.Caller(0)
+	logger.Info("m")
+	return line + 1
+}
+
+func TestSourceFrames(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		AddSource:          true,
+		SourceFrames:       2,
+		SourceBasenameOnly: true,
+		ReplaceAttr:        removeKeys(slog.TimeKey),
+		NoColor:            true,
+	})
+	_, _, callLine, _ := runtime.Caller(0)
+	helperLine := logFromHelper(slog.New(h))
+
+	want := fmt.Sprintf(" INFO m source.0=\"handler_test.go:%d\" source.1=\"handler_test.go:%d\"\n", helperLine, callLine+1)
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestFormatRecord(t *testing.T) {
+	r := slog.NewRecord(testTime, slog.LevelWarn, "disk low", 0)
+	r.AddAttrs(slog.Int("free_mb", 512), slog.Group("disk", "path", "/"))
+
+	for _, opts := range []*HandlerOptions{
+		nil,
+		{ForceColor: true},
+		{NoColor: true},
+		{ForceColor: true, TimeFormat: time.RFC3339, ReplaceAttr: upperCaseKey},
+		{ForceColor: true, SuppressEmpty: true, ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey, "free_mb", "path")},
+	} {
+		var buf bytes.Buffer
+		if err := NewHandler(&buf, opts).Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+		want := strings.TrimSuffix(buf.String(), "\n")
+		if got := FormatRecord(opts, r); got != want {
+			t.Errorf("opts %+v\ngot  %q\nwant %q", opts, got, want)
+		}
+	}
+}
+
+func TestSortGroups(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		SortGroups:  true,
+		ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+		NoColor:     true,
+	})
+	slog.New(h).Info("",
+		slog.Group("zeta", "z2", 1, "z1", 2),
+		"b", 1,
+		slog.Group("alpha", "y", 1, slog.Group("inner", "k", 2), "x", 3),
+		"a", 2,
+	)
+
+	want := `b=1 a=2 alpha.y=1 alpha.inner.k=2 alpha.x=3 zeta.z2=1 zeta.z1=2`
+	if got := strings.TrimRight(buf.String(), "\n"); got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestEmptyValueMarker(t *testing.T) {
+	for _, test := range []struct {
+		marker string
+		want   string
+	}{
+		{"", `name="" id=1 note=" "`},
+		{"∅", `name=∅ id=1 note=" "`},
+	} {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, &HandlerOptions{
+			EmptyValueMarker: test.marker,
+			ReplaceAttr:      removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+			NoColor:          true,
+		})
+		slog.New(h).Info("", "name", "", "id", 1, "note", " ")
+		if got := strings.TrimRight(buf.String(), "\n"); got != test.want {
+			t.Errorf("marker %q: got %s, want %s", test.marker, got, test.want)
+		}
+	}
+}
+
+func TestLevelRenderer(t *testing.T) {
+	for _, noColor := range []bool{false, true} {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, &HandlerOptions{
+			ForceColor: true,
+			LevelRenderer: func(level slog.Level, noColor bool) string {
+				label := "<<" + level.String() + ">>"
+				if noColor || level < slog.LevelError {
+					return label
+				}
+				return string(cliFgHiRed) + label + string(cliReset)
+			},
+			ReplaceAttr: removeKeys(slog.TimeKey),
+			NoColor:     noColor,
+		})
+		logger := slog.New(h)
+		logger.Error("m")
+		logger.Info("m")
+
+		want := string(cliFgHiRed) + "<<ERROR>>" + string(cliReset) + " m\n<<INFO>> m\n"
+		if noColor {
+			want = "<<ERROR>> m\n<<INFO>> m\n"
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("noColor=%v: got %q, want %q", noColor, got, want)
+		}
+	}
+}
+
+func TestLevelColors(t *testing.T) {
+	for _, noColor := range []bool{false, true} {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, &HandlerOptions{
+			ForceColor:  true,
+			Level:       slog.LevelDebug,
+			LevelColors: map[slog.Level]string{slog.LevelWarn: string(cliFgMagenta)},
+			ReplaceAttr: removeKeys(slog.TimeKey),
+			NoColor:     noColor,
+		})
+		logger := slog.New(h)
+		logger.Warn("m")
+		logger.Debug("m")
+		logger.Error("m")
+
+		want := []string{
+			string(cliFgMagenta) + " WARN" + string(cliReset) + " m",
+			string(cliFgBlue) + "DEBUG" + string(cliReset) + " m",
+			string(cliFgRed) + "ERROR" + string(cliReset) + " m",
+		}
+		if noColor {
+			want = []string{" WARN m", "DEBUG m", "ERROR m"}
+		}
+		got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+		if !slices.Equal(got, want) {
+			t.Errorf("noColor=%v\ngot  %q\nwant %q", noColor, got, want)
+		}
+	}
+}
+
+func TestLevelLabels(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		labels map[slog.Level]string
+		want   []string
+	}{
+		{
+			name: "single character",
+			labels: map[slog.Level]string{
+				slog.LevelDebug: "D", slog.LevelInfo: "I", slog.LevelWarn: "W", slog.LevelError: "E",
+			},
+			want: []string{"I m", "W m", "E m"},
+		},
+		{
+			name:   "lowercase",
+			labels: map[slog.Level]string{slog.LevelInfo: "info", slog.LevelWarn: "warn"},
+			want:   []string{" info m", " warn m", "ERROR m"},
+		},
+	} {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, &HandlerOptions{
+			LevelLabels: test.labels,
+			ReplaceAttr: removeKeys(slog.TimeKey),
+			NoColor:     true,
+		})
+		logger := slog.New(h)
+		logger.Info("m")
+		logger.Warn("m")
+		logger.Error("m")
+
+		got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s\ngot  %q\nwant %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLevelPrefixes(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor: true,
+		LevelPrefixes: map[slog.Level]string{
+			slog.LevelInfo:  ">> ",
+			slog.LevelError: string(cliFgRed) + "!!!" + string(cliReset) + " ",
+		},
+		ReplaceAttr: removeKeys(slog.TimeKey),
+	})
+	logger := slog.New(h)
+	logger.Info("m")
+	logger.Warn("m")
+	logger.Error("m")
+
+	red, yellow, reset := string(cliFgRed), string(cliFgYellow), string(cliReset)
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		">>   INFO m",
+		"    " + yellow + " WARN" + reset + " m",
+		red + "!!!" + reset + " " + red + "ERROR" + reset + " m",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestErrorCards(t *testing.T) {
+	orig := terminalWidth
+	terminalWidth = func(io.Writer) int { return 30 }
+	t.Cleanup(func() { terminalWidth = orig })
+
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		NoColor:     true,
+		ErrorCards:  true,
+		ForceTTY:    true,
+		ReplaceAttr: removeKeys(slog.TimeKey),
+	})
+	logger := slog.New(h)
+	logger.Info("started", "port", 8080)
+	logger.Error("upload failed", "file", "report", "err", errors.New("connection reset by peer"))
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		" INFO started port=8080",
+		"+----------------------------+",
+		"| ERROR upload failed        |",
+		"+----------------------------+",
+		"| file=\"report\"              |",
+		"| err=\"connection reset by p |",
+		"| eer\"                       |",
+		"+----------------------------+",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestErrorCardsNotTerminal(t *testing.T) {
+	orig := terminalWidth
+	terminalWidth = func(io.Writer) int { return 30 }
+	t.Cleanup(func() { terminalWidth = orig })
+
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		NoColor:     true,
+		ErrorCards:  true,
+		ReplaceAttr: removeKeys(slog.TimeKey),
+	})
+	slog.New(h).Error("upload failed", "err", errors.New("connection reset by peer while writing chunk 12"))
+
+	want := "+-------------------------------------------------------+\n" +
+		"| ERROR upload failed                                   |\n" +
+		"+-------------------------------------------------------+\n" +
+		"| err=\"connection reset by peer while writing chunk 12\" |\n" +
+		"+-------------------------------------------------------+\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestErrorCardsColor(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor:  true,
+		ErrorCards:  true,
+		ReplaceAttr: removeKeys(slog.TimeKey),
+	})
+	slog.New(h).Error("failed", "n", 1)
+
+	got := stripANSI(buf.String())
+	want := "┌──────────────┐\n" +
+		"│ ERROR failed │\n" +
+		"├──────────────┤\n" +
+		"│ n=1          │\n" +
+		"└──────────────┘\n"
+	if got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestErrorCardsTerminalWidth(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		NoColor:       true,
+		ErrorCards:    true,
+		ForceTTY:      true,
+		TerminalWidth: 12,
+		ReplaceAttr:   removeKeys(slog.TimeKey),
+	})
+	slog.New(h).Error("disk full", "free", 0)
+
+	want := "+----------+\n" +
+		"| ERROR di |\n" +
+		"| sk full  |\n" +
+		"+----------+\n" +
+		"| free=0   |\n" +
+		"+----------+\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestConcurrentHandle(t *testing.T) {
+	const goroutines, records = 50, 1000
+
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{ReplaceAttr: removeKeys(slog.TimeKey)}))
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// each goroutine logs through its own clone of the handler
+			l := logger.With("g", g)
+			for i := range records {
+				l.Info("record", "i", i, "text", strings.Repeat("x", 64))
+			}
+		}()
+	}
+	wg.Wait()
+
+	line := regexp.MustCompile(`^ INFO record g=\d+ i=\d+ text="x{64}"$`)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != goroutines*records {
+		t.Fatalf("got %d lines, want %d", len(lines), goroutines*records)
+	}
+	for _, l := range lines {
+		if !line.MatchString(l) {
+			t.Fatalf("garbled line: %q", l)
+		}
+	}
+}
+
+func TestPreferRecordAttrs(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		prefer bool
+		want   string
+	}{
+		{"off", false, ` INFO m env="prod" app.id=1 region="eu" env="staging" app.id=2`},
+		{"on", true, ` INFO m region="eu" env="staging" app.id=2`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := NewHandler(&buf, &HandlerOptions{
+				PreferRecordAttrs: test.prefer,
+				ReplaceAttr:       removeKeys(slog.TimeKey),
+			})
+			logger := slog.New(h).With("env", "prod", slog.Group("app", "id", 1), "region", "eu")
+			logger.Info("m", "env", "staging", slog.Group("app", "id", 2))
+			if got := strings.TrimRight(buf.String(), "\n"); got != test.want {
+				t.Errorf("\ngot  %q\nwant %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestKeyColor(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		ForceColor:  true,
+		KeyColor:    string(cliFgCyan),
+		ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey),
+	})
+	slog.New(h).Info("m", "a", 1, slog.Group("g", "b", "x"))
+
+	cyan, reset := string(cliFgCyan), string(cliReset)
+	want := "m " + cyan + "a=" + reset + "1 " + cyan + "g.b=" + reset + "\"x\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+
+	buf.Reset()
+	h = NewHandler(&buf, &HandlerOptions{
+		ForceColor:  true,
+		KeyColor:    string(cliFgCyan),
+		NoColor:     true,
+		ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey),
+	})
+	slog.New(h).Info("m", "a", 1)
+	if got, want := buf.String(), "m a=1\n"; got != want {
+		t.Errorf("NoColor: got %q, want %q", got, want)
+	}
+}
+
+func TestValueColors(t *testing.T) {
+	colors := map[slog.Kind]string{
+		slog.KindString:   string(cliFgMagenta),
+		slog.KindInt64:    string(cliFgGreen),
+		slog.KindUint64:   string(cliFgCyan),
+		slog.KindFloat64:  string(cliFgBlue),
+		slog.KindBool:     string(cliFgYellow),
+		slog.KindDuration: string(cliFgRed),
+		slog.KindTime:     string(cliFgWhite),
+		slog.KindAny:      string(cliFgBlack),
+	}
+	attrs := []slog.Attr{
+		slog.String("s", "x"),
+		slog.Int("i", -1),
+		slog.Uint64("u", 2),
+		slog.Float64("f", 1.5),
+		slog.Bool("b", true),
+		slog.Duration("d", time.Second),
+		slog.Time("t", testTime),
+		slog.Any("a", []int{1}),
+	}
+	for _, test := range []struct {
+		name    string
+		noColor bool
+	}{
+		{"color", false},
+		{"no color", true},
+	} {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, &HandlerOptions{
+			ForceColor:  true,
+			ValueColors: colors,
+			NoColor:     test.noColor,
+			ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+		})
+		for _, attr := range attrs {
+			buf.Reset()
+			slog.New(h).LogAttrs(context.Background(), slog.LevelInfo, "", attr)
+
+			value := formatAttrs(t, attr)[len(attr.Key)+1:]
+			want := string(cliFaint) + attr.Key + "=" + string(cliReset) + colors[attr.Value.Kind()] + value + string(cliReset) + "\n"
+			if test.noColor {
+				want = attr.Key + "=" + value + "\n"
+			}
+			if got := buf.String(); got != want {
+				t.Errorf("%s: %s: got %q, want %q", test.name, attr.Value.Kind(), got, want)
+			}
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	now := testTime
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		Level:             slog.LevelDebug,
+		LogSummaryOnClose: true,
+		Clock:             func() time.Time { return now },
+		ReplaceAttr:       removeKeys(slog.TimeKey),
+	}).(*Handler)
+	logger := slog.New(h)
+	logger.Debug("m")
+	logger.Info("m")
+	logger.Warn("m")
+	logger.With("a", 1).Warn("m")
+	logger.WithGroup("g").Warn("m")
+	logger.Log(context.Background(), slog.LevelError+4, "m")
+
+	now = now.Add(4210 * time.Millisecond)
+	if got, want := h.Summary(), "3 warnings, 1 error in 4.2s"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), " INFO 3 warnings, 1 error in 4.2s\n"; got != want {
+		t.Errorf("Close wrote %q, want %q", got, want)
+	}
+}
+
+func TestKeyValueSeparator(t *testing.T) {
+	for _, test := range []struct {
+		sep  string
+		want string
+	}{
+		{"", `a=1 "b c"="x" err="boom"`},
+		{": ", `a: 1 "b c": "x" err: "boom"`},
+		{" => ", `a => 1 "b c" => "x" err => "boom"`},
+	} {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, &HandlerOptions{
+			KeyValueSeparator: test.sep,
+			ReplaceAttr:       removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+		})
+		slog.New(h).Info("", "a", 1, "b c", "x", "err", errors.New("boom"))
+		if got := strings.TrimRight(buf.String(), "\n"); got != test.want {
+			t.Errorf("separator %q:\ngot  %q\nwant %q", test.sep, got, test.want)
+		}
+	}
+}
+
+func TestTimeValueFormat(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		TimeFormat:  time.Kitchen,
+		ReplaceAttr: removeKeys(slog.TimeKey, slog.LevelKey),
+	})
+	logger := slog.New(h)
+	logger.Info("m", "at", testTime)
+	h.(*Handler).SetTimeFormat(time.RFC3339)
+	logger.Info("m", "at", testTime)
+
+	want := "m at=\"3:04AM\"\nm at=\"2000-01-02T03:04:05Z\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestStructUseJSONTags(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+		Zip  string `json:"zip,omitempty"`
+	}
+	type user struct {
+		Name     string    `json:"name"`
+		Age      int       `json:"age,omitempty"`
+		Password string    `json:"-"`
+		Tags     []string  `json:"tags,omitempty"`
+		Home     address   `json:"home"`
+		Work     *address  `json:"work"`
+		Joined   time.Time `json:"joined"`
+		Plain    bool
+		secret   string
+	}
+	u := user{Name: "jo", Password: "hunter2", Home: address{City: "Oslo"}, Work: &address{City: "Bern"},
+		Joined: testTime, secret: "x"}
+	site, _ := url.Parse("https://example.com/a?b=c")
+
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &HandlerOptions{
+		StructUseJSONTags: true,
+		ReplaceAttr:       removeKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+	})
+	slog.New(h).Info("", "user", u, "ptr", &address{City: "Rome", Zip: "00100"}, "site", site, "n", 1)
+
+	want := `user="{name:jo home:{city:Oslo} work:{city:Bern} joined:2000-01-02 03:04:05.000000006 +0000 UTC ` +
+		`Plain:false}" ptr="{city:Rome zip:00100}" site="https://example.com/a?b=c" n=1` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestDisableTime(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts HandlerOptions
+	}{
+		{"default", HandlerOptions{DisableTime: true}},
+		{"replace attr", HandlerOptions{DisableTime: true, ReplaceAttr: upperCaseKey}},
+	} {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, &test.opts)
+		r := slog.NewRecord(testTime, slog.LevelWarn, "m", 0)
+		if err := h.Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := buf.String(), " WARN m\n"; got != want {
+			t.Errorf("%s: got %q, want %q", test.name, got, want)
+		}
+	}
+}
+
 // This benchmark is loosly based off of slog/internal/benchmarks/benchmarks_test.go
 //  https://cs.opensource.google/go/go/+/master:src/log/slog/internal/benchmarks/benchmarks_test.go
 
@@ -0,0 +1,116 @@
+// Package httplog logs HTTP client and server traffic through a [slog.Logger].
+//
+// It is kept separate from the cli package so that importing cli does not pull
+// in net/http.
+package httplog
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Transport is an [http.RoundTripper] that logs each request and its response
+type Transport struct {
+	// Base is the underlying RoundTripper (Default: http.DefaultTransport)
+	Base http.RoundTripper
+
+	// Logger receives a record for each round trip
+	Logger *slog.Logger
+}
+
+// NewTransport wraps base so that every round trip is logged to logger
+func NewTransport(base http.RoundTripper, logger *slog.Logger) *Transport {
+	return &Transport{Base: base, Logger: logger}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	ctx := req.Context()
+	if err != nil {
+		attrs := append(requestAttrs(req.Method, req.URL.String(), 0, elapsed, 0), slog.Any("err", err))
+		t.Logger.LogAttrs(ctx, slog.LevelError, "http request", attrs...)
+		return resp, err
+	}
+	t.Logger.LogAttrs(ctx, statusLevel(resp.StatusCode), "http request",
+		requestAttrs(req.Method, req.URL.String(), resp.StatusCode, elapsed, resp.ContentLength)...)
+	return resp, nil
+}
+
+// Middleware returns an [http.Handler] that logs every request served by next
+func Middleware(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		start := time.Now()
+		next.ServeHTTP(rw, r)
+		elapsed := time.Since(start)
+
+		logger.LogAttrs(r.Context(), statusLevel(rw.status), "http request",
+			requestAttrs(r.Method, r.URL.String(), rw.status, elapsed, rw.bytes)...)
+	})
+}
+
+// requestAttrs builds the consistent attribute set used for every logged request.
+// A status of 0 is omitted.
+func requestAttrs(method, url string, status int, d time.Duration, bytes int64) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("url", url),
+	}
+	if status != 0 {
+		attrs = append(attrs, slog.Int("status", status))
+	}
+	return append(attrs,
+		slog.Duration("duration", d),
+		slog.Int64("bytes", bytes),
+	)
+}
+
+// statusLevel picks the log level for an HTTP status code
+func statusLevel(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// responseWriter records the status code and body size written by a handler
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,105 @@
+package httplog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gesquive/cli"
+)
+
+// newTestLogger returns a logger writing colorless lines without the time or
+// duration, which vary between runs
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(cli.NewHandler(buf, &cli.HandlerOptions{
+		NoColor: true,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "hello")
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	client := &http.Client{Transport: NewTransport(nil, newTestLogger(&buf))}
+
+	for _, path := range []string{"/ok", "/missing"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		` INFO http request method="GET" url="` + srv.URL + `/ok" status=200 bytes=5`,
+		` WARN http request method="GET" url="` + srv.URL + `/missing" status=404 bytes=19`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("\ngot  %s\nwant %s", got[i], want[i])
+		}
+	}
+}
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestTransportError(t *testing.T) {
+	var buf bytes.Buffer
+	client := &http.Client{Transport: NewTransport(failingTransport{}, newTestLogger(&buf))}
+	if _, err := client.Get("http://example.invalid/"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	got := strings.TrimRight(buf.String(), "\n")
+	want := `ERROR http request method="GET" url="http://example.invalid/" bytes=0 err="connection refused"`
+	if got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created")
+	}), newTestLogger(&buf))
+
+	req := httptest.NewRequest(http.MethodPost, "/items", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	got := strings.TrimRight(buf.String(), "\n")
+	want := ` INFO http request method="POST" url="/items" status=201 bytes=7`
+	if got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ParseLevel parses a level name such as "debug", "INFO", "warning" or
+// "error+2" into a [slog.Level]. Names are case-insensitive.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	name := strings.TrimSpace(s)
+	if strings.EqualFold(name, "warning") {
+		return slog.LevelWarn, nil
+	}
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("cli: invalid level %q", s)
+	}
+	return level, nil
+}
+
+// defaultLevelWidth is the width of the longest built-in level label
+const defaultLevelWidth = 5
+
+// syslogLevelWidth is the width of the longest syslog level name
+const syslogLevelWidth = 7
+
+// Custom levels used to place the syslog NOTICE and CRIT severities
+const (
+	syslogLevelNotice = slog.LevelInfo + 2
+	syslogLevelCrit   = slog.LevelError + 4
+)
+
+// levelLabel returns the unpadded text used for level
+func levelLabel(level slog.Level) string {
+	switch level {
+	case slog.LevelDebug:
+		return "DEBUG"
+	case slog.LevelInfo:
+		return "INFO"
+	case slog.LevelWarn:
+		return "WARN"
+	case slog.LevelError:
+		return "ERROR"
+	default:
+		return level.String()
+	}
+}
+
+// syslogLabel returns the syslog severity name for level:
+//
+//	level < INFO              DEBUG
+//	INFO <= level < INFO+2    INFO
+//	INFO+2 <= level < WARN    NOTICE
+//	WARN <= level < ERROR     WARNING
+//	ERROR <= level < ERROR+4  ERR
+//	ERROR+4 <= level          CRIT
+func syslogLabel(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "DEBUG"
+	case level < syslogLevelNotice:
+		return "INFO"
+	case level < slog.LevelWarn:
+		return "NOTICE"
+	case level < slog.LevelError:
+		return "WARNING"
+	case level < syslogLevelCrit:
+		return "ERR"
+	default:
+		return "CRIT"
+	}
+}
+
+// levelBand rounds level down to the nearest standard level
+func levelBand(level slog.Level) slog.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return slog.LevelDebug
+	case level < slog.LevelWarn:
+		return slog.LevelInfo
+	case level < slog.LevelError:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// levelColor returns the color used for level, or "" for no color
+func levelColor(level slog.Level) cliColor {
+	switch level {
+	case slog.LevelDebug:
+		return cliFgBlue
+	case slog.LevelWarn:
+		return cliFgYellow
+	case slog.LevelError:
+		return cliFgRed
+	default:
+		return ""
+	}
+}
+
+// LevelStyle sets the label and color of the levels from Min to Max
+// inclusive. Set Min and Max to the same level to style a single level.
+type LevelStyle struct {
+	Min, Max slog.Level
+
+	// Label replaces the level name when set, e.g. "NOTICE"
+	Label string
+
+	// Color replaces the level color when set, an ANSI escape sequence such
+	// as "\033[36m"
+	Color string
+}
+
+// matchLevelStyle returns the first style in styles whose range holds level
+func matchLevelStyle(styles []LevelStyle, level slog.Level) (LevelStyle, bool) {
+	for _, s := range styles {
+		if level >= s.Min && level <= s.Max {
+			return s, true
+		}
+	}
+	return LevelStyle{}, false
+}
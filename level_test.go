@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{"INFO", slog.LevelInfo},
+		{"Warn", slog.LevelWarn},
+		{"warning", slog.LevelWarn},
+		{" error ", slog.LevelError},
+		{"info+2", slog.LevelInfo + 2},
+	} {
+		got, err := ParseLevel(test.in)
+		if err != nil {
+			t.Errorf("ParseLevel(%q): %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("ParseLevel(\"loud\") did not return an error")
+	}
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// LineWriter is an [io.Writer] that logs every line written to it as its own
+// record, which makes it suitable as the Stdout or Stderr of an [exec.Cmd].
+// Partial lines are held until they are completed; call Close to log a final
+// line that has no trailing newline. Records have the code that created the
+// writer as their source.
+type LineWriter struct {
+	logger *slog.Logger
+	level  slog.Level
+	attrs  []slog.Attr
+	pc     uintptr // source of the records
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+// NewLineWriter returns a LineWriter that logs lines at level with attrs added
+// to every record
+func NewLineWriter(logger *slog.Logger, level slog.Level, attrs ...slog.Attr) *LineWriter {
+	return &LineWriter{logger: logger, level: level, attrs: attrs, pc: sourcePC(1)}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			break
+		}
+		if len(w.partial) > 0 {
+			w.partial = append(w.partial, p[:i]...)
+			w.log(w.partial)
+			w.partial = w.partial[:0]
+		} else {
+			w.log(p[:i])
+		}
+		p = p[i+1:]
+	}
+	w.partial = append(w.partial, p...)
+	return n, nil
+}
+
+// Close logs any buffered partial line
+func (w *LineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.partial) > 0 {
+		w.log(w.partial)
+		w.partial = w.partial[:0]
+	}
+	return nil
+}
+
+func (w *LineWriter) log(line []byte) {
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	logPC(w.logger, w.level, string(line), w.attrs, w.pc)
+}
+
+// LogLines reads r until EOF and logs each line at level with attrs added to
+// every record. A final line without a trailing newline is also logged.
+func LogLines(r io.Reader, logger *slog.Logger, level slog.Level, attrs ...slog.Attr) error {
+	w := &LineWriter{logger: logger, level: level, attrs: attrs, pc: sourcePC(1)}
+	_, err := io.Copy(w, r)
+	w.Close()
+	return err
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogLines(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+
+	in := "compiling\r\nlinking\nunterminated"
+	if err := LogLines(strings.NewReader(in), logger, slog.LevelWarn, slog.String("cmd", "make")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := ` WARN compiling cmd="make"
+ WARN linking cmd="make"
+ WARN unterminated cmd="make"
+`
+	if buf.String() != want {
+		t.Errorf("\ngot  %q\nwant %q", buf.String(), want)
+	}
+}
+
+func TestLineWriterPartialWrites(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+
+	w := NewLineWriter(logger, slog.LevelInfo)
+	for _, chunk := range []string{"hel", "lo\nwor", "ld", "\n", "tail"} {
+		w.Write([]byte(chunk))
+	}
+	if got, want := buf.String(), " INFO hello\n INFO world\n"; got != want {
+		t.Errorf("before Close\ngot  %q\nwant %q", got, want)
+	}
+
+	w.Close()
+	if got, want := buf.String(), " INFO hello\n INFO world\n INFO tail\n"; got != want {
+		t.Errorf("after Close\ngot  %q\nwant %q", got, want)
+	}
+}
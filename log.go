@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+)
+
+// logAt logs msg at level with attrs like logger.LogAttrs, but records the
+// caller skip frames above the function calling logAt as the source, so that
+// with AddSource records logged by the helpers in this package point at the
+// code that called them rather than at the helper
+func logAt(logger *slog.Logger, level slog.Level, msg string, attrs []slog.Attr, skip int) {
+	logPC(logger, level, msg, attrs, sourcePC(skip+1))
+}
+
+// sourcePC returns the program counter of the caller skip frames above the
+// function calling sourcePC
+func sourcePC(skip int) uintptr {
+	var pcs [1]uintptr
+	runtime.Callers(skip+2, pcs[:]) // skip runtime.Callers and sourcePC
+	return pcs[0]
+}
+
+// logPC logs msg at level with attrs and pc as the source
+func logPC(logger *slog.Logger, level slog.Level, msg string, attrs []slog.Attr, pc uintptr) {
+	ctx := context.Background()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	r := slog.NewRecord(loggerNow(logger), level, msg, pc)
+	r.AddAttrs(attrs...)
+	_ = logger.Handler().Handle(ctx, r)
+}
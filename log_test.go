@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// sourceLogger returns a logger writing records with their source and no
+// time to buf
+func sourceLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(NewHandler(buf, &HandlerOptions{
+		AddSource:   true,
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+}
+
+func TestHelperSource(t *testing.T) {
+	t.Cleanup(defaultOnce.Reset)
+
+	for _, test := range []struct {
+		name string
+		log  func(logger *slog.Logger)
+	}{
+		{"LogError", func(logger *slog.Logger) { LogError(logger, "boom", errors.New("x")) }},
+		{"LogValidationErrors", func(logger *slog.Logger) {
+			LogValidationErrors(logger, slog.LevelWarn, "invalid", []FieldError{{Path: "port", Message: "bad"}})
+		}},
+		{"ErrorCollector", func(logger *slog.Logger) {
+			var c ErrorCollector
+			c.LogSummary(logger)
+			c.Add(errors.New("x"))
+			c.LogSummary(logger)
+		}},
+		{"DumpStack", func(logger *slog.Logger) { DumpStack(logger, slog.LevelError, "dump") }},
+		{"LogOnce", func(logger *slog.Logger) { LogOnce(logger, t.Name(), slog.LevelWarn, "once") }},
+		{"OnceSet", func(logger *slog.Logger) {
+			var s OnceSet
+			s.Log(logger, "key", slog.LevelWarn, "once")
+		}},
+		{"Span", func(logger *slog.Logger) { Span(logger, "build")() }},
+		{"Timer", func(logger *slog.Logger) {
+			timer := NewTimer()
+			timer.Mark("compile")
+			timer.Log(logger, "built")
+		}},
+		{"LineWriter", func(logger *slog.Logger) {
+			io.WriteString(NewLineWriter(logger, slog.LevelInfo), "written\n")
+		}},
+		{"LogLines", func(logger *slog.Logger) { LogLines(strings.NewReader("read\n"), logger, slog.LevelInfo) }},
+	} {
+		var buf bytes.Buffer
+		test.log(sourceLogger(&buf))
+
+		source := regexp.MustCompile(`^ ?[A-Z]+ \S+/log_test.go:\d+ `)
+		lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+		for _, line := range lines {
+			if line != "" && !strings.HasPrefix(line, "    ") && !source.MatchString(line+" ") {
+				t.Errorf("%s: source is not the caller: %q", test.name, line)
+			}
+		}
+		if lines[0] == "" {
+			t.Errorf("%s: nothing was logged", test.name)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ndjsonHandler writes records as newline delimited JSON objects with the
+// keys of a fixed schema always present
+type ndjsonHandler struct {
+	mu *sync.Mutex // shared by clones, guards w
+	w  io.Writer
+
+	schema      []string
+	level       slog.Leveler
+	addSource   bool
+	replaceAttr func([]string, slog.Attr) slog.Attr
+
+	attrs       []jsonField // resolved attributes added with WithAttrs
+	groupPrefix string
+	groups      []string
+}
+
+// jsonField is a flattened attribute with its dotted key
+type jsonField struct {
+	key   string
+	value slog.Value
+}
+
+// NewNDJSONHandler returns a handler that writes each record to w as a single
+// line JSON object, for tools such as jq or BigQuery that want a predictable
+// layout. The object always holds the keys in schema, in schema order, with
+// null for keys the record does not have. The remaining keys follow in record
+// order, starting with time, level and msg. Grouped attributes are flattened
+// to dotted keys, e.g. "http.status", which is also how they are named in
+// schema. Only the Level, AddSource and ReplaceAttr options are used.
+func NewNDJSONHandler(w io.Writer, schema []string, opts *HandlerOptions) slog.Handler {
+	if opts == nil {
+		opts = &HandlerOptions{}
+	}
+	h := &ndjsonHandler{
+		mu:          &sync.Mutex{},
+		w:           w,
+		schema:      slices.Clone(schema),
+		level:       defaultLevel,
+		addSource:   opts.AddSource,
+		replaceAttr: opts.ReplaceAttr,
+	}
+	if opts.Level != nil {
+		h.level = opts.Level
+	}
+	return h
+}
+
+func (h *ndjsonHandler) clone() *ndjsonHandler {
+	h2 := *h
+	h2.attrs = slices.Clip(h.attrs)
+	h2.groups = slices.Clip(h.groups)
+	return &h2
+}
+
+func (h *ndjsonHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *ndjsonHandler) Handle(ctx context.Context, r slog.Record) error {
+	var fields []jsonField
+	if !r.Time.IsZero() {
+		fields = h.collect(fields, slog.Time(slog.TimeKey, r.Time.Round(0)), "", nil)
+	}
+	fields = h.collect(fields, slog.Any(slog.LevelKey, r.Level), "", nil)
+	if h.addSource && r.PC != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		src := &slog.Source{Function: f.Function, File: f.File, Line: f.Line}
+		fields = h.collect(fields, slog.Any(slog.SourceKey, src), "", nil)
+	}
+	fields = h.collect(fields, slog.String(slog.MessageKey, r.Message), "", nil)
+	fields = append(fields, h.attrs...)
+	r.Attrs(func(attr slog.Attr) bool {
+		fields = h.collect(fields, attr, h.groupPrefix, h.groups)
+		return true
+	})
+
+	buf := newBuffer()
+	defer buf.Free()
+	buf.WriteByte('{')
+	for i, key := range h.schema {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		appendJSON(buf, key)
+		buf.WriteByte(':')
+		j := slices.IndexFunc(fields, func(f jsonField) bool { return f.key == key })
+		if j < 0 {
+			buf.WriteString("null")
+			continue
+		}
+		appendJSONValue(buf, fields[j].value)
+	}
+	for _, f := range fields {
+		if slices.Contains(h.schema, f.key) {
+			continue
+		}
+		if len(*buf) > 1 {
+			buf.WriteByte(',')
+		}
+		appendJSON(buf, f.key)
+		buf.WriteByte(':')
+		appendJSONValue(buf, f.value)
+	}
+	buf.WriteString("}\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(*buf)
+	return err
+}
+
+func (h *ndjsonHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := h.clone()
+	for _, attr := range attrs {
+		h2.attrs = h2.collect(h2.attrs, attr, h2.groupPrefix, h2.groups)
+	}
+	return h2
+}
+
+func (h *ndjsonHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := h.clone()
+	h2.groupPrefix += name + "."
+	h2.groups = append(h2.groups, name)
+	return h2
+}
+
+// collect resolves attr, applies ReplaceAttr and flattens groups, appending
+// the resulting fields
+func (h *ndjsonHandler) collect(fields []jsonField, attr slog.Attr, groupsPrefix string, groups []string) []jsonField {
+	attr.Value = attr.Value.Resolve()
+	if h.replaceAttr != nil && attr.Value.Kind() != slog.KindGroup {
+		attr = h.replaceAttr(groups, attr)
+		attr.Value = attr.Value.Resolve()
+	}
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			groupsPrefix += attr.Key + "."
+			groups = append(groups, attr.Key)
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			fields = h.collect(fields, groupAttr, groupsPrefix, groups)
+		}
+		return fields
+	}
+	return append(fields, jsonField{key: groupsPrefix + attr.Key, value: attr.Value})
+}
+
+// appendJSON writes v encoded as JSON
+func appendJSON(buf *buffer, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+// appendJSONValue writes v as a JSON value. Durations are written as strings
+// such as "1.5s" and times in RFC 3339 format.
+func appendJSONValue(buf *buffer, v slog.Value) {
+	switch v.Kind() {
+	case slog.KindString:
+		appendJSON(buf, v.String())
+	case slog.KindInt64:
+		*buf = strconv.AppendInt(*buf, v.Int64(), 10)
+	case slog.KindUint64:
+		*buf = strconv.AppendUint(*buf, v.Uint64(), 10)
+	case slog.KindFloat64:
+		appendJSON(buf, v.Float64())
+	case slog.KindBool:
+		*buf = strconv.AppendBool(*buf, v.Bool())
+	case slog.KindDuration:
+		appendJSON(buf, v.Duration().String())
+	case slog.KindTime:
+		appendJSON(buf, v.Time().Format(time.RFC3339Nano))
+	default:
+		switch cv := v.Any().(type) {
+		case nil:
+			buf.WriteString("null")
+		case slog.Level:
+			appendJSON(buf, cv.String())
+		case error:
+			appendJSON(buf, cv.Error())
+		case encoding.TextMarshaler:
+			data, err := cv.MarshalText()
+			if err != nil {
+				appendJSON(buf, err.Error())
+				break
+			}
+			appendJSON(buf, string(data))
+		default:
+			appendJSON(buf, cv)
+		}
+	}
+}
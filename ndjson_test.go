@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNDJSONHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewNDJSONHandler(&buf, []string{"level", "msg", "user", "http.status", "took"}, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+	})
+	logger := slog.New(h).With("app", "web")
+	logger.Info("served", "extra", 1.5, slog.Group("http", "status", 200), "user", "ren", "took", time.Second)
+	logger.Warn("no user", "err", errors.New("fail"))
+	logger.WithGroup("http").Info("nested", "status", 404)
+
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		`{"level":"INFO","msg":"served","user":"ren","http.status":200,"took":"1s","app":"web","extra":1.5}`,
+		`{"level":"WARN","msg":"no user","user":null,"http.status":null,"took":null,"app":"web","err":"fail"}`,
+		`{"level":"INFO","msg":"nested","user":null,"http.status":404,"took":null,"app":"web"}`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d\ngot  %s\nwant %s", i, got[i], want[i])
+		}
+		if !json.Valid([]byte(got[i])) {
+			t.Errorf("line %d is not valid JSON", i)
+		}
+	}
+}
+
+func TestNDJSONHandlerLevel(t *testing.T) {
+	h := NewNDJSONHandler(&bytes.Buffer{}, nil, &HandlerOptions{Level: slog.LevelWarn})
+	if h.Enabled(context.Background(), slog.LevelInfo) || !h.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("Level option was not respected")
+	}
+}
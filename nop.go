@@ -0,0 +1,20 @@
+package cli
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NopHandler is a [slog.Handler] that discards every record. Its Enabled
+// method always returns false so loggers skip formatting entirely.
+type NopHandler struct{}
+
+// Discard returns a handler that drops all log records
+func Discard() slog.Handler {
+	return NopHandler{}
+}
+
+func (NopHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (NopHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h NopHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h NopHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+// countingNop counts calls that reach Handle
+type countingNop struct {
+	NopHandler
+	calls *int
+}
+
+func (h countingNop) Handle(context.Context, slog.Record) error {
+	*h.calls++
+	return nil
+}
+
+func TestDiscard(t *testing.T) {
+	ctx := context.Background()
+	h := Discard()
+	for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+		if h.Enabled(ctx, level) {
+			t.Errorf("Discard handler enabled for %v", level)
+		}
+	}
+
+	var calls int
+	logger := slog.New(countingNop{calls: &calls})
+	logger.Info("message", "b", 2)
+	logger.Error("message", "c", 3)
+	if calls != 0 {
+		t.Errorf("Handle called %d times, want 0", calls)
+	}
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// OnceSet remembers the keys already logged through it, so a message is
+// written once per set. The zero value is ready to use and it is safe for
+// concurrent use.
+type OnceSet struct {
+	keys sync.Map
+}
+
+// defaultOnce holds the keys already logged by LogOnce
+var defaultOnce OnceSet
+
+// Log logs msg at level the first time it is called with key and does nothing
+// on later calls with the same key
+func (s *OnceSet) Log(logger *slog.Logger, key string, level slog.Level, msg string, attrs ...slog.Attr) {
+	s.log(logger, key, level, msg, attrs, 1)
+}
+
+// Reset forgets every key logged through s, so each is logged again on its
+// next use
+func (s *OnceSet) Reset() {
+	s.keys.Range(func(key, _ any) bool {
+		s.keys.Delete(key)
+		return true
+	})
+}
+
+func (s *OnceSet) log(logger *slog.Logger, key string, level slog.Level, msg string, attrs []slog.Attr, skip int) {
+	if _, seen := s.keys.LoadOrStore(key, struct{}{}); seen {
+		return
+	}
+	logAt(logger, level, msg, attrs, skip+1)
+}
+
+// LogOnce logs msg at level the first time it is called with key and does
+// nothing on later calls with the same key, e.g. for deprecation warnings that
+// would otherwise repeat. Keys are shared by all loggers in the process; use
+// an OnceSet to scope or reset them. It is safe for concurrent use.
+func LogOnce(logger *slog.Logger, key string, level slog.Level, msg string, attrs ...slog.Attr) {
+	defaultOnce.log(logger, key, level, msg, attrs, 1)
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"bytes"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+func TestLogOnce(t *testing.T) {
+	t.Cleanup(defaultOnce.Reset)
+
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			LogOnce(logger, t.Name()+"-old-flag", slog.LevelWarn, "-old is deprecated", slog.String("use", "-new"))
+		}()
+	}
+	wg.Wait()
+	LogOnce(logger, t.Name()+"-other", slog.LevelWarn, "other")
+
+	want := " WARN -old is deprecated use=\"-new\"\n WARN other\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestOnceSet(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+
+	var a, b OnceSet
+	a.Log(logger, "key", slog.LevelWarn, "a")
+	a.Log(logger, "key", slog.LevelWarn, "a again")
+	b.Log(logger, "key", slog.LevelWarn, "b")
+	a.Reset()
+	a.Log(logger, "key", slog.LevelWarn, "a after reset")
+
+	want := " WARN a\n WARN b\n WARN a after reset\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter returns a writer that prepends prefix, e.g. a service name, to
+// each line written to w, like docker compose output: "web | line". The
+// prefix is padded to width columns, e.g. the width of the longest prefix in
+// use, so the lines of several writers line up. color is an ANSI escape
+// sequence for the prefix, or "" for none. The writer can be passed to
+// NewHandler and handles writes of partial and multiple lines.
+func PrefixWriter(w io.Writer, prefix, color string, width int) io.Writer {
+	return &prefixWriter{w: w, prefix: prefix, color: color, width: width, atStart: true}
+}
+
+type prefixWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	prefix  string
+	color   string
+	width   int
+	atStart bool // the next byte starts a new line
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	buf := newBuffer()
+	defer buf.Free()
+	for rest := p; len(rest) > 0; {
+		if pw.atStart {
+			pw.appendPrefix(buf)
+		}
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		buf.Write(line)
+		rest = rest[len(line):]
+		pw.atStart = line[len(line)-1] == '\n'
+	}
+	if _, err := pw.w.Write(*buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// appendPrefix writes the padded, colored prefix and separator
+func (pw *prefixWriter) appendPrefix(buf *buffer) {
+	if pw.color != "" {
+		buf.WriteString(pw.color)
+	}
+	buf.WriteString(pw.prefix)
+	if pw.color != "" {
+		buf.WriteString(string(cliReset))
+	}
+	for n := visibleWidth(pw.prefix); n < pw.width; n++ {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(" | ")
+}
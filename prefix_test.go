@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	web := PrefixWriter(&buf, "web", "", 8)
+	db := PrefixWriter(&buf, "postgres", string(cliFgCyan), 8)
+
+	io.WriteString(web, "starting\nlisten")
+	io.WriteString(web, "ing on :80\n")
+	io.WriteString(db, "ready\n\ndone\n")
+
+	logger := slog.New(NewHandler(web, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+	logger.Info("served", "path", "/")
+
+	cyan, reset := string(cliFgCyan), string(cliReset)
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		"web      | starting",
+		"web      | listening on :80",
+		cyan + "postgres" + reset + " | ready",
+		cyan + "postgres" + reset + " | ",
+		cyan + "postgres" + reset + " | done",
+		`web      |  INFO served path="/"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"io"
+	"log/slog"
+	"time"
+)
+
+// DevOptions returns options suited to local development: colored output, the
+// source location of each record and a short wall clock time. The returned
+// options may be modified before being passed to [NewHandler].
+func DevOptions() *HandlerOptions {
+	return &HandlerOptions{
+		AddSource:  true,
+		TimeFormat: time.TimeOnly,
+		NoColor:    false,
+	}
+}
+
+// ProdOptions returns options suited to production log collection: plain
+// logfmt style output without color or source locations and RFC 3339
+// timestamps in UTC. The returned options may be modified before being passed
+// to [NewHandler].
+func ProdOptions() *HandlerOptions {
+	return &HandlerOptions{
+		AddSource:  false,
+		TimeFormat: time.RFC3339,
+		UTC:        true,
+		NoColor:    true,
+	}
+}
+
+// NewLoggerFromFlags returns a logger writing to w configured from common
+// command line flags. verbosity is the number of times a -v style flag was
+// given: a negative value logs warnings and errors only, 0 logs info and
+// above, 1 adds debug records and 2 or more also adds source locations. When
+// jsonMode is set records are written as JSON instead of the CLI format.
+func NewLoggerFromFlags(w io.Writer, verbosity int, jsonMode bool) *slog.Logger {
+	level := verbosityLevel(verbosity)
+	addSource := verbosity >= 2
+
+	if jsonMode {
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+			AddSource: addSource,
+			Level:     level,
+		}))
+	}
+	return slog.New(NewHandler(w, &HandlerOptions{
+		AddSource: addSource,
+		Level:     level,
+	}))
+}
+
+// verbosityLevel maps a verbosity count to the minimum level to log
+func verbosityLevel(verbosity int) slog.Level {
+	switch {
+	case verbosity < 0:
+		return slog.LevelWarn
+	case verbosity == 0:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
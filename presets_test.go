@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDevOptions(t *testing.T) {
+	opts := DevOptions()
+	if !opts.AddSource || opts.NoColor || opts.TimeFormat != time.TimeOnly {
+		t.Errorf("unexpected dev options %+v", opts)
+	}
+}
+
+func TestProdOptions(t *testing.T) {
+	opts := ProdOptions()
+	if opts.AddSource || !opts.NoColor || !opts.UTC || opts.TimeFormat != time.RFC3339 {
+		t.Errorf("unexpected prod options %+v", opts)
+	}
+
+	var buf bytes.Buffer
+	h := NewHandler(&buf, opts)
+	tm := time.Date(2000, 1, 2, 3, 4, 5, 0, time.FixedZone("EST", -5*60*60))
+	if err := h.Handle(context.Background(), slog.NewRecord(tm, slog.LevelInfo, "m", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "2000-01-02T08:04:05Z  INFO m\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPresetOverride(t *testing.T) {
+	opts := ProdOptions()
+	opts.Level = slog.LevelDebug
+	h := NewHandler(&bytes.Buffer{}, opts)
+	if !h.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("override of preset Level was ignored")
+	}
+	if ProdOptions().Level != nil {
+		t.Error("modifying returned options changed later presets")
+	}
+}
+
+func TestNewLoggerFromFlags(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		verbosity int
+		jsonMode  bool
+		enabled   slog.Level
+		disabled  slog.Level
+		want      string
+	}{
+		{verbosity: -1, enabled: slog.LevelWarn, disabled: slog.LevelInfo, want: " WARN m"},
+		{verbosity: 0, enabled: slog.LevelInfo, disabled: slog.LevelDebug, want: " INFO m"},
+		{verbosity: 1, enabled: slog.LevelDebug, disabled: slog.LevelDebug - 1, want: "DEBUG m"},
+		{verbosity: 2, enabled: slog.LevelDebug, disabled: slog.LevelDebug - 1, want: "/presets_test.go:"},
+		{verbosity: 0, jsonMode: true, enabled: slog.LevelInfo, disabled: slog.LevelDebug, want: `"level":"INFO","msg":"m"`},
+	} {
+		var buf bytes.Buffer
+		logger := NewLoggerFromFlags(&buf, test.verbosity, test.jsonMode)
+		if !logger.Enabled(ctx, test.enabled) || logger.Enabled(ctx, test.disabled) {
+			t.Errorf("verbosity %d: wrong levels enabled", test.verbosity)
+		}
+
+		logger.Log(ctx, test.enabled, "m")
+		if got := stripANSI(buf.String()); !strings.Contains(got, test.want) {
+			t.Errorf("verbosity %d json %v: got %q, want it to contain %q", test.verbosity, test.jsonMode, got, test.want)
+		}
+	}
+}
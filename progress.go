@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// clearLine erases from the cursor to the end of the terminal line
+const clearLine = "\033[K"
+
+// ProgressLogger logs progress updates that overwrite each other in place on a
+// terminal. When the writer is not a terminal every update is written as a
+// regular line instead.
+type ProgressLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	h      *Handler
+	tty    bool
+	last   slog.Record
+	active bool
+}
+
+// Progress returns a ProgressLogger writing to w
+func Progress(w io.Writer) *ProgressLogger {
+	return ProgressWithOptions(w, nil)
+}
+
+// ProgressWithOptions is like Progress but formats updates with opts. Set
+// ForceTTY to draw updates in place on a writer that is not a terminal.
+func ProgressWithOptions(w io.Writer, opts *HandlerOptions) *ProgressLogger {
+	h := NewHandler(w, opts).(*Handler)
+	return &ProgressLogger{
+		w:   w,
+		h:   h,
+		tty: h.tty,
+	}
+}
+
+// Update replaces the current progress line with msg and attrs
+func (p *ProgressLogger) Update(msg string, attrs ...slog.Attr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := slog.NewRecord(p.h.now(), slog.LevelInfo, msg, 0)
+	r.AddAttrs(attrs...)
+	p.last = r
+	if !p.tty {
+		p.h.Handle(context.Background(), r)
+		return
+	}
+
+	buf := newBuffer()
+	defer buf.Free()
+	line, ok := p.h.format(context.Background(), buf, r)
+	if !ok {
+		return
+	}
+	out := append([]byte{'\r'}, line...)
+	out = append(out, clearLine...)
+	p.w.Write(out)
+	p.active = true
+}
+
+// Done finishes the progress line by writing the last update as a regular,
+// newline terminated record
+func (p *ProgressLogger) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.active {
+		return
+	}
+	io.WriteString(p.w, "\r"+clearLine)
+	p.h.Handle(context.Background(), p.last)
+	p.active = false
+}
+
+// maxBarWidth is the widest a progress bar is drawn, brackets included
+const maxBarWidth = 42
+
+// progressStep is the percent a ProgressBarLogger advances by between the
+// lines it logs when the writer is not a terminal
+const progressStep = 10
+
+// ProgressBarLogger draws a determinate progress bar, e.g. [####----] 50%,
+// that updates in place on a terminal. When the writer is not a terminal a
+// regular progress record is logged every 10 percent instead.
+type ProgressBarLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	h      *Handler
+	tty    bool
+	total  int64
+	logged int // last percent logged when not a terminal
+	done   bool
+}
+
+// ProgressBar returns a ProgressBarLogger writing to w for a task of total
+// units, such as bytes to download
+func ProgressBar(w io.Writer, total int64) *ProgressBarLogger {
+	return ProgressBarWithOptions(w, total, nil)
+}
+
+// ProgressBarWithOptions is like ProgressBar but formats progress records with
+// opts. Set ForceTTY and TerminalWidth to draw the bar in place at a fixed
+// width on a writer that is not a terminal.
+func ProgressBarWithOptions(w io.Writer, total int64, opts *HandlerOptions) *ProgressBarLogger {
+	h := NewHandler(w, opts).(*Handler)
+	return &ProgressBarLogger{
+		w:      w,
+		h:      h,
+		tty:    h.tty,
+		total:  total,
+		logged: -1,
+	}
+}
+
+// Set updates the bar to current units done. The bar is finished with a
+// newline once current reaches the total.
+func (b *ProgressBarLogger) Set(current int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.done {
+		return
+	}
+	current = min(max(current, 0), b.total)
+	percent := 100
+	if b.total > 0 {
+		percent = int(current * 100 / b.total)
+	}
+	b.done = current >= b.total
+
+	if !b.tty {
+		if step := percent / progressStep * progressStep; step > b.logged {
+			b.logged = step
+			r := slog.NewRecord(b.h.now(), slog.LevelInfo, "progress", 0)
+			r.AddAttrs(slog.Int("percent", percent), slog.Int64("current", current), slog.Int64("total", b.total))
+			b.h.Handle(context.Background(), r)
+		}
+		return
+	}
+
+	// the percent is right aligned in room for 100% so the bar keeps its size
+	suffix := " " + padLeft(strconv.Itoa(percent)+"%", 4)
+	width := min(b.h.width()-visibleWidth(suffix), maxBarWidth) - 2
+	if width < 1 {
+		width = 1
+	}
+	filled := width * percent / 100
+
+	buf := newBuffer()
+	defer buf.Free()
+	buf.WriteString("\r[")
+	buf.WriteString(strings.Repeat("#", filled))
+	buf.WriteString(strings.Repeat("-", width-filled))
+	buf.WriteByte(']')
+	buf.WriteString(suffix)
+	buf.WriteString(clearLine)
+	if b.done {
+		buf.WriteByte('\n')
+	}
+	b.w.Write(*buf)
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// fakeTerminal makes isTerminal report tty for the duration of the test
+func fakeTerminal(t *testing.T, tty bool) {
+	orig := isTerminal
+	isTerminal = func(io.Writer) bool { return tty }
+	t.Cleanup(func() { isTerminal = orig })
+}
+
+// fakeClock makes clock return tm for the duration of the test
+func fakeClock(t *testing.T, tm time.Time) {
+	orig := clock
+	clock = func() time.Time { return tm }
+	t.Cleanup(func() { clock = orig })
+}
+
+func TestProgressTerminal(t *testing.T) {
+	fakeTerminal(t, true)
+	fakeClock(t, testTime)
+	t.Setenv("TERM", "xterm")
+
+	var buf bytes.Buffer
+	p := Progress(&buf)
+	p.Update("downloading", slog.Int("done", 1))
+	p.Update("downloading", slog.Int("done", 2))
+	p.Done()
+
+	key := string(cliFaint) + "done=" + string(cliReset)
+	want := "\r2000-01-02 03:04:05  INFO downloading " + key + "1" + clearLine +
+		"\r2000-01-02 03:04:05  INFO downloading " + key + "2" + clearLine +
+		"\r" + clearLine +
+		"2000-01-02 03:04:05  INFO downloading " + key + "2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestProgressNotTerminal(t *testing.T) {
+	fakeTerminal(t, false)
+	fakeClock(t, testTime)
+
+	var buf bytes.Buffer
+	p := Progress(&buf)
+	p.Update("downloading", slog.Int("done", 1))
+	p.Update("downloading", slog.Int("done", 2))
+	p.Done()
+
+	want := "2000-01-02 03:04:05  INFO downloading done=1\n" +
+		"2000-01-02 03:04:05  INFO downloading done=2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestProgressBarTerminal(t *testing.T) {
+	fakeTerminal(t, true)
+	orig := terminalWidth
+	terminalWidth = func(io.Writer) int { return 15 }
+	t.Cleanup(func() { terminalWidth = orig })
+
+	var buf bytes.Buffer
+	b := ProgressBar(&buf, 200)
+	b.Set(0)
+	b.Set(100)
+	b.Set(250)
+	b.Set(300) // ignored once finished
+
+	want := "\r[--------]   0%" + clearLine +
+		"\r[####----]  50%" + clearLine +
+		"\r[########] 100%" + clearLine + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestProgressBarNotTerminal(t *testing.T) {
+	fakeTerminal(t, false)
+	fakeClock(t, testTime)
+
+	var buf bytes.Buffer
+	b := ProgressBar(&buf, 1000)
+	for _, n := range []int64{0, 50, 120, 150, 560, 1000} {
+		b.Set(n)
+	}
+
+	want := "2000-01-02 03:04:05  INFO progress percent=0 current=0 total=1000\n" +
+		"2000-01-02 03:04:05  INFO progress percent=12 current=120 total=1000\n" +
+		"2000-01-02 03:04:05  INFO progress percent=56 current=560 total=1000\n" +
+		"2000-01-02 03:04:05  INFO progress percent=100 current=1000 total=1000\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestProgressForceTTY(t *testing.T) {
+	fakeClock(t, testTime)
+
+	var buf bytes.Buffer
+	p := ProgressWithOptions(&buf, &HandlerOptions{ForceTTY: true, NoColor: true})
+	p.Update("downloading", slog.Int("done", 1))
+	p.Done()
+
+	want := "\r2000-01-02 03:04:05  INFO downloading done=1" + clearLine +
+		"\r" + clearLine +
+		"2000-01-02 03:04:05  INFO downloading done=1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestProgressBarForceTTY(t *testing.T) {
+	var buf bytes.Buffer
+	b := ProgressBarWithOptions(&buf, 100, &HandlerOptions{ForceTTY: true, TerminalWidth: 11})
+	b.Set(50)
+	b.Set(100)
+
+	want := "\r[##--]  50%" + clearLine +
+		"\r[####] 100%" + clearLine + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var inReader = bufio.NewReader(os.Stdin)
+
+// SetInputReader allows you to set the reader that prompts read answers from,
+// by default os.Stdin is used
+func SetInputReader(r io.Reader) {
+	inReader = bufio.NewReader(r)
+}
+
+// Confirm writes prompt followed by [y/N] or [Y/n] to the output writer and
+// reads an answer from the input reader. y, yes, n and no are accepted in any
+// case, an empty answer selects the default and anything else asks again. If
+// the input ends before an answer is given, false is returned with io.EOF.
+func Confirm(prompt string, defaultYes bool) (bool, error) {
+	choices := "[y/N]"
+	if defaultYes {
+		choices = "[Y/n]"
+	}
+
+	for {
+		fmt.Fprintf(outWriter, "%s %s ", SprintfYellow("%s", prompt), choices)
+
+		line, err := inReader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			fmt.Fprintln(outWriter)
+			return false, err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "":
+			return defaultYes, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		if err == io.EOF {
+			fmt.Fprintln(outWriter)
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	setColor(t, false)
+	defer SetInputReader(os.Stdin)
+
+	for _, test := range []struct {
+		name       string
+		input      string
+		defaultYes bool
+		want       bool
+		wantErr    error
+	}{
+		{"yes", "y\n", false, true, nil},
+		{"YES", "YES\n", false, true, nil},
+		{"no", "n\n", true, false, nil},
+		{"No", " No \n", true, false, nil},
+		{"default yes", "\n", true, true, nil},
+		{"default no", "\n", false, false, nil},
+		{"retry", "maybe\nyes\n", false, true, nil},
+		{"windows line ending", "y\r\n", false, true, nil},
+		{"no newline", "yes", false, true, nil},
+		{"eof", "", true, false, io.EOF},
+		{"eof after invalid", "maybe", true, false, io.EOF},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			setOutputWriter(t, &out)
+			SetInputReader(strings.NewReader(test.input))
+
+			got, err := Confirm("Delete everything?", test.defaultYes)
+			if err != test.wantErr {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestConfirmPrompt(t *testing.T) {
+	setColor(t, false)
+	var out bytes.Buffer
+	setOutputWriter(t, &out)
+	SetInputReader(strings.NewReader("what\nn\n"))
+	defer SetInputReader(os.Stdin)
+
+	if _, err := Confirm("Continue?", true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "Continue? [Y/n] Continue? [Y/n] "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,22 @@
+package cli
+
+import "log/slog"
+
+// ChainReplaceAttr combines ReplaceAttr functions into one that applies them
+// in order, passing each the attribute returned by the previous one. Once a
+// function drops the attribute by returning the zero Attr the rest are
+// skipped. nil functions are ignored.
+func ChainReplaceAttr(fns ...func([]string, slog.Attr) slog.Attr) func([]string, slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		for _, fn := range fns {
+			if fn == nil {
+				continue
+			}
+			a = fn(groups, a)
+			if a.Equal(slog.Attr{}) {
+				return a
+			}
+		}
+		return a
+	}
+}
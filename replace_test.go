@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestChainReplaceAttr(t *testing.T) {
+	var calls []string
+	record := func(name string, fn func([]string, slog.Attr) slog.Attr) func([]string, slog.Attr) slog.Attr {
+		return func(groups []string, a slog.Attr) slog.Attr {
+			calls = append(calls, name)
+			return fn(groups, a)
+		}
+	}
+	redact := record("redact", func(_ []string, a slog.Attr) slog.Attr {
+		if a.Key == "password" {
+			return slog.Attr{}
+		}
+		return a
+	})
+	upper := record("upper", upperCaseKey)
+	suffix := record("suffix", func(_ []string, a slog.Attr) slog.Attr {
+		a.Key += "_x"
+		return a
+	})
+	chain := ChainReplaceAttr(redact, nil, upper, suffix)
+
+	if got := chain(nil, slog.Int("port", 80)); got.Key != "PORT_x" {
+		t.Errorf("got key %q, want %q", got.Key, "PORT_x")
+	}
+	if got, want := strings.Join(calls, ","), "redact,upper,suffix"; got != want {
+		t.Errorf("got calls %s, want %s", got, want)
+	}
+
+	calls = nil
+	if got := chain(nil, slog.String("password", "hunter2")); !got.Equal(slog.Attr{}) {
+		t.Errorf("got %v, want the zero Attr", got)
+	}
+	if got, want := strings.Join(calls, ","), "redact"; got != want {
+		t.Errorf("got calls %s after a drop, want %s", got, want)
+	}
+}
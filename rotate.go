@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// RotatingWriter is an [io.Writer] that writes to a log file and rotates it
+// once it grows past a maximum size or age. Rotated files are renamed to
+// name.1, name.2, ... with name.1 being the most recent. It is safe for
+// concurrent use. Handlers writing to a RotatingWriter never emit color.
+type RotatingWriter struct {
+	filename   string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// NewRotatingWriter opens filename for appending, creating it if needed.
+// The file is rotated before a write would take it past maxSize bytes or once
+// it is older than maxAge. At most maxBackups rotated files are kept. A zero
+// value disables the corresponding limit.
+func NewRotatingWriter(filename string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingWriter, error) {
+	w := &RotatingWriter{
+		filename:   filename,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.needsRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file, renames it to a backup and opens a new one
+func (w *RotatingWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// Close closes the current file
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *RotatingWriter) needsRotate(n int) bool {
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(n) > w.maxSize {
+		return true
+	}
+	return w.maxAge > 0 && clock().Sub(w.opened) >= w.maxAge
+}
+
+func (w *RotatingWriter) open() error {
+	f, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	w.opened = clock()
+	return nil
+}
+
+func (w *RotatingWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+
+	// count the existing backups, pruning any past the limit
+	n := 0
+	for exists(w.backupName(n + 1)) {
+		n++
+	}
+	if w.maxBackups > 0 {
+		for ; n >= w.maxBackups; n-- {
+			if err := os.Remove(w.backupName(n)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := n; i >= 1; i-- {
+		if err := os.Rename(w.backupName(i), w.backupName(i+1)); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(w.filename, w.backupName(1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return w.open()
+}
+
+func (w *RotatingWriter) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", w.filename, i)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingWriterSize(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotatingWriter(name, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := readFile(t, name), "four\n"; got != want {
+		t.Errorf("current file = %q, want %q", got, want)
+	}
+	if got, want := readFile(t, name+".1"), "three\n"; got != want {
+		t.Errorf("backup 1 = %q, want %q", got, want)
+	}
+	if got, want := readFile(t, name+".2"), "one\ntwo\n"; got != want {
+		t.Errorf("backup 2 = %q, want %q", got, want)
+	}
+}
+
+func TestRotatingWriterPrune(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotatingWriter(name, 5, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"1111\n", "2222\n", "3333\n", "4444\n", "5555\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := readFile(t, name), "5555\n"; got != want {
+		t.Errorf("current file = %q, want %q", got, want)
+	}
+	if got, want := readFile(t, name+".1"), "4444\n"; got != want {
+		t.Errorf("backup 1 = %q, want %q", got, want)
+	}
+	if got, want := readFile(t, name+".2"), "3333\n"; got != want {
+		t.Errorf("backup 2 = %q, want %q", got, want)
+	}
+	if exists(name + ".3") {
+		t.Error("backup 3 was not pruned")
+	}
+}
+
+func TestRotatingWriterAge(t *testing.T) {
+	now := testTime
+	orig := clock
+	clock = func() time.Time { return now }
+	defer func() { clock = orig }()
+
+	name := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotatingWriter(name, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("old\n"))
+	now = now.Add(time.Hour)
+	w.Write([]byte("new\n"))
+
+	if got, want := readFile(t, name), "new\n"; got != want {
+		t.Errorf("current file = %q, want %q", got, want)
+	}
+	if got, want := readFile(t, name+".1"), "old\n"; got != want {
+		t.Errorf("backup 1 = %q, want %q", got, want)
+	}
+}
+
+func TestRotatingWriterNoColor(t *testing.T) {
+	t.Setenv("TERM", "xterm")
+	name := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotatingWriter(name, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	h := NewHandler(w, nil)
+	if h.(*Handler).ColorEnabled() {
+		t.Error("color enabled for a RotatingWriter")
+	}
+	slog.New(h).Warn("warn", "a", 1)
+	if got := readFile(t, name); strings.Contains(got, "\033[") {
+		t.Errorf("log file contains color codes: %q", got)
+	}
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strings"
+)
+
+// maxStackSize bounds the size of stacks captured by DumpStack
+const maxStackSize = 64 << 10
+
+// multilineValue is a string value the handler writes on indented lines after
+// its key instead of quoting it onto a single line
+type multilineValue string
+
+// Multiline returns a value for s, such as captured command output, that the
+// handler writes on indented lines after its key instead of quoting it onto a
+// single line. Attributes that follow it start on a new line. Other handlers
+// see s as a plain string.
+//
+//	logger.Info("command failed", slog.Any("output", cli.Multiline(out)))
+func Multiline(s string) slog.Value {
+	return slog.AnyValue(multilineValue(s))
+}
+
+// DumpStack logs msg at level with the stack of the calling goroutine under
+// the "stack" key, written as indented lines after the record. Stacks larger
+// than 64 KiB are truncated. Nothing is captured if level is not enabled.
+func DumpStack(logger *slog.Logger, level slog.Level, msg string) {
+	if !logger.Enabled(context.Background(), level) {
+		return
+	}
+	buf := make([]byte, maxStackSize)
+	n := runtime.Stack(buf, false)
+	stack := strings.TrimRight(string(buf[:n]), "\n")
+	logAt(logger, level, msg, []slog.Attr{slog.Any("stack", multilineValue(stack))}, 1)
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestDumpStack(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+	DumpStack(logger, slog.LevelError, "panic recovered")
+
+	got := buf.String()
+	if !strings.HasPrefix(got, "ERROR panic recovered stack=\n    goroutine ") {
+		t.Errorf("unexpected start of record %q", got)
+	}
+	if !strings.Contains(got, "\n    github.com/gesquive/cli.TestDumpStack(") {
+		t.Errorf("stack does not contain the calling function:\n%s", got)
+	}
+	for _, line := range strings.Split(strings.TrimRight(got, "\n"), "\n")[1:] {
+		if !strings.HasPrefix(line, "    ") {
+			t.Errorf("stack line %q is not indented", line)
+		}
+	}
+}
+
+func TestDumpStackDisabled(t *testing.T) {
+	logger := slog.New(NewHandler(io.Discard, &HandlerOptions{Level: slog.LevelInfo}))
+	if n := testing.AllocsPerRun(10, func() { DumpStack(logger, slog.LevelDebug, "m") }); n != 0 {
+		t.Errorf("DumpStack below the level allocated %v times", n)
+	}
+}
+
+func TestMultilineDelimiters(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		MultilineDelimiters: [2]string{"<<", ">>"},
+		ReplaceAttr:         removeKeys(slog.TimeKey),
+		NoColor:             true,
+	}))
+	logger.Info("output", slog.Any("lines", Multiline("first line\nsecond line")), slog.Int("next", 1))
+	logger.Info("output", slog.Any("lines", Multiline("last")))
+
+	want := " INFO output lines=<<\n    first line\n    second line\n    >>\n next=1\n" +
+		" INFO output lines=<<\n    last\n    >>\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestMultilineFollowingAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+	logger.Info("output", slog.Any("lines", Multiline("a\nb")), slog.Int("next", 1))
+
+	want := " INFO output lines=\n    a\n    b\n next=1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"io"
+	"strings"
+)
+
+// Table writes headers and rows to w as aligned columns separated by two
+// spaces, with a dashed line under the headers. Headers are colored with
+// SprintfBlue, so they follow the SetColor setting. Cells may contain ANSI
+// color codes and wide characters; columns are sized by their visible width.
+func Table(w io.Writer, headers []string, rows [][]string) {
+	columns := len(headers)
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+
+	widths := make([]int, columns)
+	for i, cell := range headers {
+		widths[i] = visibleWidth(cell)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], visibleWidth(cell))
+		}
+	}
+
+	var b strings.Builder
+	if len(headers) > 0 {
+		colored := make([]string, len(headers))
+		for i, cell := range headers {
+			colored[i] = SprintfBlue("%s", cell)
+		}
+		writeTableRow(&b, widths, colored)
+
+		dashes := make([]string, columns)
+		for i, width := range widths {
+			dashes[i] = strings.Repeat("-", width)
+		}
+		writeTableRow(&b, widths, dashes)
+	}
+	for _, row := range rows {
+		writeTableRow(&b, widths, row)
+	}
+	io.WriteString(w, b.String())
+}
+
+// writeTableRow writes cells padded on the right to widths. The last column is
+// not padded.
+func writeTableRow(b *strings.Builder, widths []int, cells []string) {
+	var line strings.Builder
+	for i := range widths {
+		if i > 0 {
+			line.WriteString("  ")
+		}
+		cell := ""
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		line.WriteString(cell)
+		if i < len(widths)-1 {
+			line.WriteString(strings.Repeat(" ", widths[i]-visibleWidth(cell)))
+		}
+	}
+	b.WriteString(strings.TrimRight(line.String(), " "))
+	b.WriteByte('\n')
+}
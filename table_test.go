@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	setColor(t, false)
+
+	var buf bytes.Buffer
+	Table(&buf, []string{"NAME", "CITY", "COUNT"}, [][]string{
+		{"ren", "東京", "1"},
+		{"stimpy", "Zürich", "12"},
+		{"x", "", "300"},
+		{"short"},
+	})
+
+	want := "NAME    CITY    COUNT\n" +
+		"------  ------  -----\n" +
+		"ren     東京    1\n" +
+		"stimpy  Zürich  12\n" +
+		"x               300\n" +
+		"short\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTableColor(t *testing.T) {
+	setColor(t, true)
+
+	var buf bytes.Buffer
+	Table(&buf, []string{"A", "B"}, [][]string{{Red("%s", "err"), "x"}})
+
+	want := SprintfBlue("A") + "    " + SprintfBlue("B") + "\n" +
+		"---  -\n" +
+		Red("%s", "err") + "  x\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/mattn/go-isatty"
+)
+
+// isTerminal reports whether w is an interactive terminal. It is a variable so
+// tests can fake a terminal.
+var isTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// defaultTerminalWidth is used when the terminal width is unknown
+const defaultTerminalWidth = 80
+
+// terminalWidth returns the width of the terminal w writes to in columns. It
+// uses the COLUMNS environment variable and falls back to 80. It is a variable
+// so tests can fake the width.
+var terminalWidth = func(w io.Writer) int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultTerminalWidth
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Span logs "<msg> started" with attrs and returns a function that logs
+// "<msg> finished" with the same attrs, any extra attrs and the elapsed time
+// under the "elapsed" key. It is meant to be deferred:
+//
+//	defer cli.Span(logger, "build")()
+func Span(logger *slog.Logger, msg string, attrs ...slog.Attr) func(...slog.Attr) {
+	start := loggerNow(logger)
+	logAt(logger, slog.LevelInfo, msg+" started", attrs, 1)
+
+	return func(extra ...slog.Attr) {
+		elapsed := loggerNow(logger).Sub(start)
+		end := make([]slog.Attr, 0, len(attrs)+len(extra)+1)
+		end = append(end, attrs...)
+		end = append(end, extra...)
+		end = append(end, slog.Duration("elapsed", elapsed))
+		logAt(logger, slog.LevelInfo, msg+" finished", end, 1)
+	}
+}
+
+// Timer records the time spent in consecutive phases of a task, such as the
+// steps of a build. It is not safe for concurrent use.
+type Timer struct {
+	last     time.Time
+	segments []slog.Attr
+}
+
+// NewTimer returns a Timer whose first segment starts now
+func NewTimer() *Timer {
+	return &Timer{last: clock()}
+}
+
+// Mark ends the current segment, recording the time since the previous mark
+// under label, and starts the next one
+func (t *Timer) Mark(label string) {
+	now := clock()
+	t.segments = append(t.segments, slog.Duration(label, now.Sub(t.last)))
+	t.last = now
+}
+
+// Log logs msg at info level with each marked segment, in order, in a
+// timings group, e.g. timings.compile="1.2s"
+func (t *Timer) Log(logger *slog.Logger, msg string) {
+	logAt(logger, slog.LevelInfo, msg,
+		[]slog.Attr{{Key: "timings", Value: slog.GroupValue(t.segments...)}}, 1)
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSpan(t *testing.T) {
+	now := testTime
+	orig := clock
+	clock = func() time.Time { return now }
+	defer func() { clock = orig }()
+
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+
+	func() {
+		defer Span(logger, "build", slog.String("target", "all"))(slog.Int("files", 3))
+		now = now.Add(1500 * time.Millisecond)
+	}()
+
+	want := ` INFO build started target="all"
+ INFO build finished target="all" files=3 elapsed="1.5s"
+`
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestSpanHandlerClock(t *testing.T) {
+	now := testTime
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		TimeFormat: time.TimeOnly,
+		NoColor:    true,
+		Clock:      func() time.Time { return now },
+	}))
+
+	func() {
+		defer Span(logger, "build")()
+		now = now.Add(2 * time.Second)
+	}()
+
+	want := "03:04:05  INFO build started\n03:04:07  INFO build finished elapsed=\"2s\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	now := testTime
+	orig := clock
+	clock = func() time.Time { return now }
+	defer func() { clock = orig }()
+
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &HandlerOptions{
+		ReplaceAttr: removeKeys(slog.TimeKey),
+		NoColor:     true,
+	}))
+
+	timer := NewTimer()
+	now = now.Add(250 * time.Millisecond)
+	timer.Mark("fetch")
+	now = now.Add(2 * time.Second)
+	timer.Mark("compile")
+	now = now.Add(time.Second)
+	timer.Mark("link")
+	timer.Log(logger, "build done")
+
+	want := ` INFO build done timings.fetch="250ms" timings.compile="2s" timings.link="1s"` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// visibleWidth returns the number of terminal columns s occupies. ANSI escape
+// sequences take no space and wide East Asian characters take two columns.
+func visibleWidth(s string) int {
+	width := 0
+	for i := 0; i < len(s); {
+		if n := ansiLen(s[i:]); n > 0 {
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// truncateWidth shortens the plain text s so that it occupies at most width
+// columns
+func truncateWidth(s string, width int) string {
+	w := 0
+	for i, r := range s {
+		rw := runeWidth(r)
+		if w+rw > width {
+			return s[:i]
+		}
+		w += rw
+	}
+	return s
+}
+
+// wrapWidth splits the plain text s into lines that each occupy at most width
+// columns. A rune wider than width is put on a line of its own.
+func wrapWidth(s string, width int) []string {
+	var lines []string
+	for s != "" {
+		line := truncateWidth(s, width)
+		if line == "" {
+			_, size := utf8.DecodeRuneInString(s)
+			line = s[:size]
+		}
+		lines = append(lines, line)
+		s = s[len(line):]
+	}
+	return lines
+}
+
+// padLeft pads s with spaces on the left to width columns
+func padLeft(s string, width int) string {
+	for n := visibleWidth(s); n < width; n++ {
+		s = " " + s
+	}
+	return s
+}
+
+// stripANSI removes ANSI CSI escape sequences from s
+func stripANSI(s string) string {
+	if !strings.Contains(s, "\033[") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if n := ansiLen(s[i:]); n > 0 {
+			i += n
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+// ansiLen returns the length of the ANSI CSI escape sequence at the start of s,
+// or 0 if s does not start with one
+func ansiLen(s string) int {
+	if len(s) < 2 || s[0] != '\033' || s[1] != '[' {
+		return 0
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// runeWidth returns the number of columns r occupies in a terminal
+func runeWidth(r rune) int {
+	switch {
+	case r == 0 || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || unicode.Is(unicode.Cf, r):
+		return 0
+	case !unicode.IsPrint(r):
+		return 0
+	case isWide(r):
+		return 2
+	}
+	return 1
+}
+
+// isWide reports whether r is a wide or full-width East Asian character, or an
+// emoji presented as wide
+func isWide(r rune) bool {
+	return r >= 0x1100 && (r <= 0x115f || // Hangul Jamo
+		r == 0x2329 || r == 0x232a ||
+		(r >= 0x2e80 && r <= 0xa4cf && r != 0x303f) || // CJK ... Yi
+		(r >= 0xac00 && r <= 0xd7a3) || // Hangul Syllables
+		(r >= 0xf900 && r <= 0xfaff) || // CJK Compatibility Ideographs
+		(r >= 0xfe30 && r <= 0xfe4f) || // CJK Compatibility Forms
+		(r >= 0xff00 && r <= 0xff60) || // Fullwidth Forms
+		(r >= 0xffe0 && r <= 0xffe6) ||
+		(r >= 0x1f300 && r <= 0x1f64f) || // Misc Symbols and Pictographs, Emoticons
+		(r >= 0x1f900 && r <= 0x1f9ff) || // Supplemental Symbols and Pictographs
+		(r >= 0x20000 && r <= 0x3fffd))
+}
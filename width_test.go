@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVisibleWidth(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"INFO", 4},
+		{string(cliFgRed) + "ERROR" + string(cliReset), 5},
+		{"héllo", 5},
+		{"日本語", 6},
+		{"á", 1},
+	} {
+		if got := visibleWidth(test.in); got != test.want {
+			t.Errorf("visibleWidth(%q) = %d, want %d", test.in, got, test.want)
+		}
+	}
+}
+
+func TestTruncateWidth(t *testing.T) {
+	for _, test := range []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"WARNING", 4, "WARN"},
+		{"INFO", 5, "INFO"},
+		{"日本語", 3, "日"},
+	} {
+		if got := truncateWidth(test.in, test.width); got != test.want {
+			t.Errorf("truncateWidth(%q, %d) = %q, want %q", test.in, test.width, got, test.want)
+		}
+	}
+}
+
+func TestWrapWidth(t *testing.T) {
+	for _, test := range []struct {
+		in    string
+		width int
+		want  []string
+	}{
+		{"WARNING", 4, []string{"WARN", "ING"}},
+		{"INFO", 5, []string{"INFO"}},
+		{"日本語", 3, []string{"日", "本", "語"}},
+		{"日本", 1, []string{"日", "本"}},
+	} {
+		if got := wrapWidth(test.in, test.width); !slices.Equal(got, test.want) {
+			t.Errorf("wrapWidth(%q, %d) = %q, want %q", test.in, test.width, got, test.want)
+		}
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	in := string(cliFaint) + "key=" + string(cliReset) + "value"
+	if got, want := stripANSI(in), "key=value"; got != want {
+		t.Errorf("stripANSI(%q) = %q, want %q", in, got, want)
+	}
+}